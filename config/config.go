@@ -14,16 +14,27 @@ import (
 )
 
 type cliFlags struct {
-	lang    string
-	log     string
-	src     string
-	cc      bool
-	retries int
+	lang      string
+	log       string
+	src       string
+	cc        bool
+	retries   int
+	format    string
+	convert   bool
+	memory    string
+	bilingual bool
+	sentences bool
+	reflow    string
+	shift     string
+	stretch   string
+	fpsConv   string
+	syncTo    string
 }
 
 type Config struct {
 	CC               bool
 	Lang             string
+	Langs            []string
 	LogLevel         string
 	LogPath          string
 	MonitorPaths     []string
@@ -31,6 +42,42 @@ type Config struct {
 	KeepSrcFile      bool
 	Retries          int
 	SaveOutputAsMain bool
+	Backend          string
+	LibreTransURL    string
+	LibreTransAPIKey string
+	DeepLAuthKey     string
+	DeepLFormality   string
+	DeepLGlossaries  map[string]string
+	LLMURL           string
+	LLMAPIKey        string
+	LLMModel         string
+	LLMTemperature   float64
+	LLMSystemPrompt  string
+	LLMContextCues   int
+	FPS              float64
+	OutputFormat     string
+	Convert          bool
+	OutputEncoding   string
+	OutputBOM        bool
+	MemoryPath       string
+	MemoryCmd        string
+	GlossaryPaths    []string
+	ProjectGlossary  string
+	Bilingual        bool
+	BilingualItalic  bool
+	BilingualColor   string
+	BilingualOrigTop bool
+	Sentences        bool
+	SentenceByTiming bool
+	Reflow           bool
+	ReflowPreset     string
+	ReflowLines      int
+	ReflowChars      int
+	ReflowCPS        float64
+	TimingShift      string
+	TimingStretch    string
+	TimingFPS        string
+	SyncTo           string
 }
 
 const (
@@ -52,6 +99,64 @@ const (
 	retriesVal      = "0"
 	saveDestMainKey = "SAVE_OUTPUT_AS_MAIN_FILE"
 	saveDestMainVal = "false"
+	backendKey      = "BACKEND"
+	backendVal      = "google"
+	libreURLKey     = "LIBRETRANSLATE_URL"
+	libreURLVal     = "http://localhost:5000"
+	libreAPIKeyKey  = "LIBRETRANSLATE_API_KEY"
+	libreAPIKeyVal  = ""
+	deeplKey        = "DEEPL_AUTH_KEY"
+	deeplVal        = ""
+	formalityKey    = "DEEPL_FORMALITY"
+	formalityVal    = "default"
+	glossariesKey   = "DEEPL_GLOSSARIES"
+	glossariesVal   = ""
+	llmURLKey       = "LLM_URL"
+	llmURLVal       = "http://localhost:11434/v1"
+	llmAPIKeyKey    = "LLM_API_KEY"
+	llmAPIKeyVal    = ""
+	llmModelKey     = "LLM_MODEL"
+	llmModelVal     = "llama3"
+	llmTempKey      = "LLM_TEMPERATURE"
+	llmTempVal      = "0.2"
+	llmPromptKey    = "LLM_SYSTEM_PROMPT"
+	llmPromptVal    = ""
+	llmContextKey   = "LLM_CONTEXT_CUES"
+	llmContextVal   = "3"
+	fpsKey          = "FPS"
+	fpsVal          = "23.976"
+	outFormatKey    = "OUTPUT_FORMAT"
+	outFormatVal    = ""
+	outEncodingKey  = "OUTPUT_ENCODING"
+	outEncodingVal  = "utf-8"
+	outBOMKey       = "OUTPUT_BOM"
+	outBOMVal       = "false"
+	memoryPathKey   = "MEMORY_PATH"
+	memoryPathVal   = "translation_memory.jsonl"
+	glossaryKey     = "GLOSSARY_PATHS"
+	glossaryVal     = ""
+	projGlossaryKey = "PROJECT_GLOSSARY"
+	projGlossaryVal = "transub.glossary"
+	bilingualKey    = "BILINGUAL_OUTPUT"
+	bilingualVal    = "false"
+	biItalicKey     = "BILINGUAL_ITALIC"
+	biItalicVal     = "true"
+	biColorKey      = "BILINGUAL_COLOR"
+	biColorVal      = ""
+	biOrigTopKey    = "BILINGUAL_ORIGINAL_FIRST"
+	biOrigTopVal    = "false"
+	sentencesKey    = "MERGE_SENTENCES"
+	sentencesVal    = "false"
+	sentSplitKey    = "SENTENCE_SPLIT"
+	sentSplitVal    = "chars"
+	reflowKey       = "REFLOW_PRESET"
+	reflowVal       = "none"
+	reflowLinesKey  = "REFLOW_LINES"
+	reflowLinesVal  = "0"
+	reflowCharsKey  = "REFLOW_LINE_CHARS"
+	reflowCharsVal  = "0"
+	reflowCPSKey    = "REFLOW_MAX_CPS"
+	reflowCPSVal    = "0"
 )
 
 var cfg Config
@@ -71,21 +176,55 @@ func Get() *Config {
 }
 
 func setConfigFromCliFlags(args cliFlags) {
+	// config file is optional here and only its backend settings are used,
+	// every other feature comes from the flags
+	if _, err := os.Stat(ConfigFilename); err == nil {
+		setBackendFromFile()
+	}
 	cfg.DoNotMonitor = true
 	cfg.CC = args.cc
-	cfg.Lang = args.lang
+	cfg.Langs = parseLangs(args.lang)
+	cfg.Lang = cfg.Langs[0]
 	cfg.LogPath = args.log
 	cfg.LogLevel = "DEBUG"
 	cfg.MonitorPaths = []string{args.src}
 	cfg.Retries = args.retries
+	cfg.Convert = args.convert
+	cfg.MemoryCmd = args.memory
+	if args.bilingual {
+		cfg.Bilingual = true
+	}
+	if args.sentences {
+		cfg.Sentences = true
+	}
+	if len(args.reflow) > 0 {
+		setReflowPreset(args.reflow)
+	}
+	cfg.TimingShift = args.shift
+	cfg.TimingStretch = args.stretch
+	cfg.TimingFPS = args.fpsConv
+	cfg.SyncTo = args.syncTo
+	if len(args.format) > 0 {
+		cfg.OutputFormat = args.format
+	}
 }
 
 func getCliFlags() (cliFlags, bool) {
-	langPtr := flag.String("lang", lang_default, "language that you want to translato to")
+	langPtr := flag.String("lang", lang_default, "language that you want to translato to. eg: pt or pt,es,fr")
 	srcPtr := flag.String("src", "", "path to srt file ")
 	logPtr := flag.String("log", "", "path to log file")
 	ccPtr := flag.Bool("cc", false, "keep close captions [CC]")
 	rtPtr := flag.Int("rt", 0, "number of retries attempts")
+	formatPtr := flag.String("format", "", "output subtitle format (srt, vtt, ass, ssa, sub, ttml...)")
+	convertPtr := flag.Bool("convert", false, "only convert -src to -format and/or retime it, without translating")
+	bilingualPtr := flag.Bool("bilingual", false, "keep the original text along with the translation")
+	reflowPtr := flag.String("reflow", "", "reflow the translated lines with a preset (netflix, bbc) or none")
+	shiftPtr := flag.String("shift", "", "shift every cue, eg: -1.5s or 00:00:02,500")
+	stretchPtr := flag.String("stretch", "", "stretch between two anchors, eg: \"00:01:00,000=00:01:02,000;01:30:00,000=01:31:10,000\"")
+	fpsConvPtr := flag.String("fps-convert", "", "convert the timing between frame rates, eg: 23.976:25")
+	syncToPtr := flag.String("sync-to", "", "retime -src to the cues of this reference subtitle, eg: the original language one of the new release")
+	sentencesPtr := flag.Bool("sentences", false, "translate sentences spanning several cues as a whole")
+	memoryPtr := flag.String("memory", "", "translation memory command: inspect, export [-src file], import -src file or purge")
 
 	flag.Parse()
 
@@ -95,14 +234,24 @@ func getCliFlags() (cliFlags, bool) {
 	}
 
 	args := cliFlags{
-		lang:    *langPtr,
-		log:     logPath,
-		src:     *srcPtr,
-		cc:      *ccPtr,
-		retries: *rtPtr,
+		lang:      *langPtr,
+		log:       logPath,
+		src:       *srcPtr,
+		cc:        *ccPtr,
+		retries:   *rtPtr,
+		format:    strings.ToLower(*formatPtr),
+		convert:   *convertPtr,
+		memory:    strings.ToLower(*memoryPtr),
+		bilingual: *bilingualPtr,
+		sentences: *sentencesPtr,
+		reflow:    strings.ToLower(*reflowPtr),
+		shift:     *shiftPtr,
+		stretch:   *stretchPtr,
+		fpsConv:   *fpsConvPtr,
+		syncTo:    *syncToPtr,
 	}
 
-	if len(args.src) == 0 {
+	if len(args.src) == 0 && len(args.memory) == 0 {
 		return args, false
 	}
 
@@ -110,14 +259,6 @@ func getCliFlags() (cliFlags, bool) {
 		args.lang = lang_default
 	}
 
-	if args.lang != lang_default {
-		lang, err := gtrans.GetValidLanguageKey(args.lang)
-		if err != nil || lang == "auto" {
-			log.Println("invalid lang " + args.lang)
-			args.lang = lang_default
-		}
-	}
-
 	if args.retries < 0 {
 		args.retries = 0
 	}
@@ -125,7 +266,57 @@ func getCliFlags() (cliFlags, bool) {
 	return args, true
 }
 
+func setReflowPreset(value string) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if len(value) == 0 || value == "none" {
+		cfg.ReflowPreset = ""
+		return
+	}
+	cfg.ReflowPreset = value
+	cfg.Reflow = true
+}
+
+// parseLangs reads a comma separated list of languages, eg: "pt, es, fr".
+// Invalid ones are dropped, it falls back to lang_default when none is left
+func parseLangs(value string) []string {
+	var langs []string
+	for _, langStr := range strings.Split(value, ",") {
+		langStr = strings.TrimSpace(langStr)
+		if len(langStr) == 0 {
+			continue
+		}
+		lang, err := gtrans.GetValidLanguageKey(langStr)
+		if err != nil || lang == "auto" {
+			log.Println("invalid lang " + langStr)
+			continue
+		}
+		langs = append(langs, lang)
+	}
+	if len(langs) == 0 {
+		langs = []string{lang_default}
+	}
+	return langs
+}
+
 func setConfigFromFile() {
+	readConfigFile(func(key string) bool { return true })
+}
+
+// setBackendFromFile reads the backend credentials and the translation
+// memory of the config file, for the CLI runs
+func setBackendFromFile() {
+	backendKeys := []string{backendKey, "LIBRETRANSLATE_", "DEEPL_", "LLM_", memoryPathKey}
+	readConfigFile(func(key string) bool {
+		for _, prefix := range backendKeys {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func readConfigFile(useKey func(key string) bool) {
 	readFile, err := os.Open(ConfigFilename)
 	if err != nil {
 		createDefaultConfigFile()
@@ -139,6 +330,10 @@ func setConfigFromFile() {
 
 	for fileScanner.Scan() {
 		line := strings.TrimSpace(fileScanner.Text())
+		key, _, _ := strings.Cut(line, "=")
+		if !useKey(strings.TrimSpace(key)) {
+			continue
+		}
 		configFileHandler(line)
 	}
 
@@ -150,7 +345,7 @@ func setConfigFromFile() {
 func configFileHandler(text string) *Config {
 
 	splitText := func(ln string) (key, value string, err error) {
-		splited := strings.Split(text, "=")
+		splited := strings.SplitN(text, "=", 2)
 		if len(splited) < 2 {
 			err = fmt.Errorf("invalid comand line")
 			return "", "", err
@@ -178,13 +373,8 @@ func configFileHandler(text string) *Config {
 	}
 
 	if strings.HasPrefix(key, langKey) {
-		lang, err := gtrans.GetValidLanguageKey(value)
-		if err != nil || lang == "auto" {
-			cfg.Lang = lang_default
-			log.Println(err)
-		} else {
-			cfg.Lang = lang
-		}
+		cfg.Langs = parseLangs(value)
+		cfg.Lang = cfg.Langs[0]
 		return &cfg
 	}
 
@@ -234,6 +424,215 @@ func configFileHandler(text string) *Config {
 		return &cfg
 	}
 
+	if strings.HasPrefix(key, backendKey) {
+		cfg.Backend = strings.ToLower(value)
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, libreURLKey) {
+		cfg.LibreTransURL = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, libreAPIKeyKey) {
+		cfg.LibreTransAPIKey = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, deeplKey) {
+		cfg.DeepLAuthKey = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, formalityKey) {
+		cfg.DeepLFormality = strings.ToLower(value)
+		return &cfg
+	}
+
+	// eg: DEEPL_GLOSSARIES = en-pt:glossary-id, en-es:another-glossary-id
+	if strings.HasPrefix(key, glossariesKey) {
+		cfg.DeepLGlossaries = map[string]string{}
+		for _, pair := range strings.Split(value, ",") {
+			langs, id, found := strings.Cut(strings.TrimSpace(pair), ":")
+			if !found {
+				continue
+			}
+			cfg.DeepLGlossaries[strings.ToLower(langs)] = strings.TrimSpace(id)
+		}
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, llmURLKey) {
+		cfg.LLMURL = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, llmAPIKeyKey) {
+		cfg.LLMAPIKey = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, llmModelKey) {
+		cfg.LLMModel = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, llmTempKey) {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			temperature = 0
+		}
+		cfg.LLMTemperature = temperature
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, llmPromptKey) {
+		cfg.LLMSystemPrompt = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, llmContextKey) {
+		intVal, err := strconv.Atoi(value)
+		if err != nil {
+			intVal = 0
+		}
+		cfg.LLMContextCues = intVal
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, fpsKey) {
+		fps, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			fps = 0
+		}
+		cfg.FPS = fps
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, outFormatKey) {
+		cfg.OutputFormat = strings.ToLower(value)
+		return &cfg
+	}
+
+	// utf-8, utf-16le, utf-16be, windows-1252, iso-8859-2 or source
+	if strings.HasPrefix(key, outEncodingKey) {
+		cfg.OutputEncoding = strings.ToLower(value)
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, outBOMKey) {
+		bom, err := strconv.ParseBool(value)
+		if err != nil {
+			bom = false
+		}
+		cfg.OutputBOM = bom
+		return &cfg
+	}
+
+	// global glossaries, comma separated
+	if strings.HasPrefix(key, glossaryKey) {
+		for _, strPath := range strings.Split(value, ",") {
+			if strPath = strings.TrimSpace(strPath); len(strPath) > 0 {
+				cfg.GlossaryPaths = append(cfg.GlossaryPaths, filepath.FromSlash(strPath))
+			}
+		}
+		return &cfg
+	}
+
+	// glossary filename looked up next to each subtitle and its parent folders
+	if strings.HasPrefix(key, projGlossaryKey) {
+		cfg.ProjectGlossary = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, bilingualKey) {
+		bilingual, err := strconv.ParseBool(value)
+		if err != nil {
+			bilingual = false
+		}
+		cfg.Bilingual = bilingual
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, biItalicKey) {
+		italic, err := strconv.ParseBool(value)
+		if err != nil {
+			italic = false
+		}
+		cfg.BilingualItalic = italic
+		return &cfg
+	}
+
+	// eg: #ffff00
+	if strings.HasPrefix(key, biColorKey) {
+		cfg.BilingualColor = value
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, biOrigTopKey) {
+		origTop, err := strconv.ParseBool(value)
+		if err != nil {
+			origTop = false
+		}
+		cfg.BilingualOrigTop = origTop
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, sentencesKey) {
+		sentences, err := strconv.ParseBool(value)
+		if err != nil {
+			sentences = false
+		}
+		cfg.Sentences = sentences
+		return &cfg
+	}
+
+	// netflix, bbc or none. The limits below override the preset ones
+	if strings.HasPrefix(key, reflowKey) {
+		setReflowPreset(value)
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, reflowLinesKey) {
+		lines, err := strconv.Atoi(value)
+		if err == nil && lines > 0 {
+			cfg.ReflowLines = lines
+			cfg.Reflow = true
+		}
+		return &cfg
+	}
+
+	if strings.HasPrefix(key, reflowCharsKey) {
+		chars, err := strconv.Atoi(value)
+		if err == nil && chars > 0 {
+			cfg.ReflowChars = chars
+			cfg.Reflow = true
+		}
+		return &cfg
+	}
+
+	// characters per second, cues read faster than this are reported
+	if strings.HasPrefix(key, reflowCPSKey) {
+		cps, err := strconv.ParseFloat(value, 64)
+		if err == nil && cps > 0 {
+			cfg.ReflowCPS = cps
+			cfg.Reflow = true
+		}
+		return &cfg
+	}
+
+	// chars or timing, how a sentence translation is split back on its cues
+	if strings.HasPrefix(key, sentSplitKey) {
+		cfg.SentenceByTiming = strings.ToLower(value) == "timing"
+		return &cfg
+	}
+
+	// empty disables the translation memory
+	if strings.HasPrefix(key, memoryPathKey) {
+		cfg.MemoryPath = filepath.FromSlash(value)
+		return &cfg
+	}
+
 	return &cfg
 }
 
@@ -254,6 +653,35 @@ func createDefaultConfigFile() {
 		fmt.Sprintf("%s = %s", monitorPathKey, monitorPathVal),
 		fmt.Sprintf("%s = %s", retriesKey, retriesVal),
 		fmt.Sprintf("%s = %s", saveDestMainKey, saveDestMainVal),
+		fmt.Sprintf("%s = %s", backendKey, backendVal),
+		fmt.Sprintf("%s = %s", libreURLKey, libreURLVal),
+		fmt.Sprintf("%s = %s", libreAPIKeyKey, libreAPIKeyVal),
+		fmt.Sprintf("%s = %s", deeplKey, deeplVal),
+		fmt.Sprintf("%s = %s", formalityKey, formalityVal),
+		fmt.Sprintf("%s = %s", glossariesKey, glossariesVal),
+		fmt.Sprintf("%s = %s", llmURLKey, llmURLVal),
+		fmt.Sprintf("%s = %s", llmAPIKeyKey, llmAPIKeyVal),
+		fmt.Sprintf("%s = %s", llmModelKey, llmModelVal),
+		fmt.Sprintf("%s = %s", llmTempKey, llmTempVal),
+		fmt.Sprintf("%s = %s", llmPromptKey, llmPromptVal),
+		fmt.Sprintf("%s = %s", llmContextKey, llmContextVal),
+		fmt.Sprintf("%s = %s", fpsKey, fpsVal),
+		fmt.Sprintf("%s = %s", outFormatKey, outFormatVal),
+		fmt.Sprintf("%s = %s", outEncodingKey, outEncodingVal),
+		fmt.Sprintf("%s = %s", outBOMKey, outBOMVal),
+		fmt.Sprintf("%s = %s", memoryPathKey, memoryPathVal),
+		fmt.Sprintf("%s = %s", glossaryKey, glossaryVal),
+		fmt.Sprintf("%s = %s", projGlossaryKey, projGlossaryVal),
+		fmt.Sprintf("%s = %s", bilingualKey, bilingualVal),
+		fmt.Sprintf("%s = %s", biItalicKey, biItalicVal),
+		fmt.Sprintf("%s = %s", biColorKey, biColorVal),
+		fmt.Sprintf("%s = %s", biOrigTopKey, biOrigTopVal),
+		fmt.Sprintf("%s = %s", sentencesKey, sentencesVal),
+		fmt.Sprintf("%s = %s", sentSplitKey, sentSplitVal),
+		fmt.Sprintf("%s = %s", reflowKey, reflowVal),
+		fmt.Sprintf("%s = %s", reflowLinesKey, reflowLinesVal),
+		fmt.Sprintf("%s = %s", reflowCharsKey, reflowCharsVal),
+		fmt.Sprintf("%s = %s", reflowCPSKey, reflowCPSVal),
 	}
 
 	for _, cfg := range cfgs {
@@ -1,6 +1,7 @@
 package dirmonitor
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
@@ -16,8 +17,23 @@ import (
 
 var cfg *config.Config
 
-func Setup(config *config.Config) {
+// ctx is done on shutdown, the running translations are cancelled with it
+var ctx = context.Background()
+var memory *transub.Memory
+var glossary *transub.Glossary
+
+func Setup(setupCtx context.Context, config *config.Config) {
+	ctx = setupCtx
 	cfg = config
+	var err error
+	if len(cfg.MemoryPath) > 0 {
+		if memory, err = transub.OpenMemory(cfg.MemoryPath); err != nil {
+			logger.Err(err)
+		}
+	}
+	if glossary, err = transub.LoadGlossary(cfg.GlossaryPaths...); err != nil {
+		logger.Err(err)
+	}
 	var paths []string
 	for _, baseDir := range cfg.MonitorPaths {
 		filenames := findFilesPathsToTranslate(baseDir, cfg.Lang)
@@ -26,16 +42,16 @@ func Setup(config *config.Config) {
 	translateBatch(paths)
 }
 
+// Watch translates the new subtitle files until ctx is done
 func Watch() {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		logger.Panic(err)
 	}
 	defer watcher.Close()
-	done := make(chan bool)
 	go monitorLoop(watcher)
 	addMonitorPathsWatchers(watcher)
-	<-done
+	<-ctx.Done()
 }
 
 func findFilesPathsToTranslate(baseDir, lang string) []string {
@@ -46,15 +62,9 @@ func findFilesPathsToTranslate(baseDir, lang string) []string {
 			return err
 		}
 
-		isSrtFile := filepath.Ext(d.Name()) == ".srt"
-		isSSaFile := filepath.Ext(d.Name()) == ".ssa"
-		isMkvFile := filepath.Ext(d.Name()) == ".mkv"
-		if isSSaFile || isSrtFile {
+		if _, isSubtitleFile := transub.FormatFromFilename(d.Name()); isSubtitleFile {
 			subtitlePaths = append(subtitlePaths, path)
 		}
-		if isMkvFile {
-			fmt.Println("FILE, p", path)
-		}
 
 		return nil
 	})
@@ -77,6 +87,9 @@ func monitorLoop(watcher *fsnotify.Watcher) {
 
 		case err := <-watcher.Errors:
 			logger.Err(err)
+
+		case <-ctx.Done():
+			return
 		}
 	}
 }
@@ -113,28 +126,65 @@ func translateOneWG(wg *sync.WaitGroup, filename string) error {
 }
 
 func translateOne(filename string) error {
-	ts := transub.New(
+	if _, ok := transub.FormatFromFilename(filename); !ok {
+		return fmt.Errorf("invalid extension - this should never hapen")
+	}
+	ts := transub.NewMultiLang(
 		filename,
-		cfg.Lang,
+		cfg.Langs,
+		transub.WithMemory(memory),
+		transub.WithGlossary(glossary),
+		transub.WithProjectGlossary(cfg.ProjectGlossary),
+		transub.WithBilingual(transub.BilingualCfg{
+			Enabled:       cfg.Bilingual,
+			OriginalFirst: cfg.BilingualOrigTop,
+			Italic:        cfg.BilingualItalic,
+			Color:         cfg.BilingualColor,
+		}),
+		transub.WithSentences(transub.SentenceCfg{
+			Enabled:  cfg.Sentences,
+			ByTiming: cfg.SentenceByTiming,
+		}),
+		transub.WithReflow(transub.ReflowCfg{
+			Enabled:  cfg.Reflow,
+			Preset:   cfg.ReflowPreset,
+			MaxLines: cfg.ReflowLines,
+			MaxChars: cfg.ReflowChars,
+			MaxCPS:   cfg.ReflowCPS,
+		}),
 		transub.WithRemoveCC(!cfg.CC),
 		transub.WithMainSub(cfg.SaveOutputAsMain),
 		transub.WithRemoveOrigin(!cfg.KeepSrcFile),
+		transub.WithFPS(cfg.FPS),
+		transub.WithOutputFormat(transub.Format(cfg.OutputFormat)),
+		transub.WithOutputEncoding(transub.Encoding(cfg.OutputEncoding)),
+		transub.WithOutputBOM(cfg.OutputBOM),
+		transub.WithBackend(cfg.Backend),
+		transub.WithLibreTranslateCfg(transub.LibreTranslateCfg{
+			URL:    cfg.LibreTransURL,
+			APIKey: cfg.LibreTransAPIKey,
+		}),
+		transub.WithDeepLCfg(transub.DeepLCfg{
+			AuthKey:    cfg.DeepLAuthKey,
+			Formality:  cfg.DeepLFormality,
+			Glossaries: cfg.DeepLGlossaries,
+		}),
+		transub.WithLLMCfg(transub.LLMCfg{
+			URL:           cfg.LLMURL,
+			APIKey:        cfg.LLMAPIKey,
+			Model:         cfg.LLMModel,
+			Temperature:   cfg.LLMTemperature,
+			SystemPrompt:  cfg.LLMSystemPrompt,
+			ContextWindow: cfg.LLMContextCues,
+		}),
 	)
 
-	ext := filepath.Ext(filename)
-	var err error
-	if ext == ".srt" {
-		// if err := ts.TranslasteSRT(); err != nil {
-		//     logger.Err(err)
-		//     return err
-		// }
-		fmt.Println("VOLTAR O SRT HEIN!!")
-		//return ts.TranslasteSRT()
-		return err
+	res, err := ts.TranslateContext(ctx)
+	for _, warning := range res.Warnings {
+		logger.Info(filename, warning)
 	}
-	if ext == ".ssa" {
-		return ts.TranslateSSA()
+	if err == nil {
+		logger.Info(res)
 	}
-
-	return fmt.Errorf("invalid extension - this should never hapen")
+	return err
 }
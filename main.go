@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/lcapuano-app/go-translate-subtitle-file/config"
 	"github.com/lcapuano-app/go-translate-subtitle-file/dirmonitor"
@@ -26,28 +30,205 @@ func main() {
 	cfg := config.New()
 	logger.SetLogger(cfg.LogPath, cfg.LogLevel)
 
+	if len(cfg.SyncTo) > 0 {
+		resyncOnce(cfg)
+		return
+	}
+
+	if cfg.Convert {
+		convertOnce(cfg)
+		return
+	}
+
+	if len(cfg.MemoryCmd) > 0 {
+		memoryOnce(cfg)
+		return
+	}
+
+	// Ctrl+C cancels the running translations, leaving no partial output
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	if cfg.DoNotMonitor {
-		translateOnce(cfg)
+		translateOnce(ctx, cfg)
 		return
 	}
 
-	dirmonitor.Setup(cfg)
+	dirmonitor.Setup(ctx, cfg)
 	dirmonitor.Watch()
 
 }
 
-func translateOnce(cfg *config.Config) {
+func translateOnce(ctx context.Context, cfg *config.Config) {
 	if len(cfg.MonitorPaths) == 0 {
 		return
 	}
-	ts := transub.New(
+	memory, err := openMemory(cfg)
+	if err != nil {
+		logger.Err(err)
+	}
+	glossary, err := transub.LoadGlossary(cfg.GlossaryPaths...)
+	if err != nil {
+		logger.Err(err)
+	}
+	timing, err := transub.ParseTimingCfg(cfg.TimingShift, cfg.TimingStretch, cfg.TimingFPS)
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+	ts := transub.NewMultiLang(
 		cfg.MonitorPaths[0],
-		cfg.Lang,
+		cfg.Langs,
+		transub.WithMemory(memory),
+		transub.WithGlossary(glossary),
+		transub.WithProjectGlossary(cfg.ProjectGlossary),
+		transub.WithBilingual(transub.BilingualCfg{
+			Enabled:       cfg.Bilingual,
+			OriginalFirst: cfg.BilingualOrigTop,
+			Italic:        cfg.BilingualItalic,
+			Color:         cfg.BilingualColor,
+		}),
+		transub.WithSentences(transub.SentenceCfg{
+			Enabled:  cfg.Sentences,
+			ByTiming: cfg.SentenceByTiming,
+		}),
+		transub.WithReflow(transub.ReflowCfg{
+			Enabled:  cfg.Reflow,
+			Preset:   cfg.ReflowPreset,
+			MaxLines: cfg.ReflowLines,
+			MaxChars: cfg.ReflowChars,
+			MaxCPS:   cfg.ReflowCPS,
+		}),
 		transub.WithRemoveCC(!cfg.CC),
 		transub.WithGoogleRetries(cfg.Retries),
+		transub.WithFPS(cfg.FPS),
+		transub.WithTiming(timing),
+		transub.WithOutputFormat(transub.Format(cfg.OutputFormat)),
+		transub.WithOutputEncoding(transub.Encoding(cfg.OutputEncoding)),
+		transub.WithOutputBOM(cfg.OutputBOM),
+		transub.WithBackend(cfg.Backend),
+		transub.WithLibreTranslateCfg(transub.LibreTranslateCfg{
+			URL:    cfg.LibreTransURL,
+			APIKey: cfg.LibreTransAPIKey,
+		}),
+		transub.WithDeepLCfg(transub.DeepLCfg{
+			AuthKey:    cfg.DeepLAuthKey,
+			Formality:  cfg.DeepLFormality,
+			Glossaries: cfg.DeepLGlossaries,
+		}),
+		transub.WithLLMCfg(transub.LLMCfg{
+			URL:           cfg.LLMURL,
+			APIKey:        cfg.LLMAPIKey,
+			Model:         cfg.LLMModel,
+			Temperature:   cfg.LLMTemperature,
+			SystemPrompt:  cfg.LLMSystemPrompt,
+			ContextWindow: cfg.LLMContextCues,
+		}),
 	)
-	if err := ts.TranslasteSRT(); err != nil {
+	res, err := ts.TranslateContext(ctx)
+	for _, warning := range res.Warnings {
+		logger.Info(warning)
+	}
+	if err != nil {
 		logger.Err(err)
+		return
 	}
+	logger.Info(res)
 	logger.Info("done")
 }
+
+func convertOnce(cfg *config.Config) {
+	if len(cfg.MonitorPaths) == 0 {
+		return
+	}
+	timing, err := transub.ParseTimingCfg(cfg.TimingShift, cfg.TimingStretch, cfg.TimingFPS)
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+	output, err := transub.ConvertFile(cfg.MonitorPaths[0], transub.Format(cfg.OutputFormat), transub.WithTiming(timing))
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+	logger.Info("converted to", output)
+}
+
+func resyncOnce(cfg *config.Config) {
+	if len(cfg.MonitorPaths) == 0 {
+		return
+	}
+	output, report, err := transub.ResyncFile(cfg.MonitorPaths[0], cfg.SyncTo)
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+	logger.Info(fmt.Sprintf("synced to %s: %d cues matched, %d moved by the nearest match, %d pieces",
+		output, report.Matched, report.Unmatched, report.Pieces))
+}
+
+// openMemory returns a nil memory when MEMORY_PATH is empty
+func openMemory(cfg *config.Config) (*transub.Memory, error) {
+	if len(cfg.MemoryPath) == 0 {
+		return nil, nil
+	}
+	return transub.OpenMemory(cfg.MemoryPath)
+}
+
+func memoryOnce(cfg *config.Config) {
+	if len(cfg.MemoryPath) == 0 {
+		logger.Err(fmt.Errorf("MEMORY_PATH is not set on %s", config.ConfigFilename))
+		return
+	}
+	memory, err := transub.OpenMemory(cfg.MemoryPath)
+	if err != nil {
+		logger.Err(err)
+		return
+	}
+	filename := ""
+	if len(cfg.MonitorPaths) > 0 {
+		filename = cfg.MonitorPaths[0]
+	}
+
+	switch cfg.MemoryCmd {
+	case "inspect":
+		for _, entry := range memory.Entries() {
+			fmt.Printf("[%s %s>%s] %s => %s\n", entry.Backend, entry.Src, entry.Dest, entry.Text, entry.Translation)
+		}
+		fmt.Printf("%d entries on %s\n", len(memory.Entries()), cfg.MemoryPath)
+	case "export":
+		out := os.Stdout
+		if len(filename) > 0 {
+			if out, err = os.Create(filename); err != nil {
+				logger.Err(err)
+				return
+			}
+			defer out.Close()
+		}
+		if err = memory.Export(out); err != nil {
+			logger.Err(err)
+		}
+	case "import":
+		file, err := os.Open(filename)
+		if err != nil {
+			logger.Err(err)
+			return
+		}
+		defer file.Close()
+		imported, err := memory.Import(file)
+		if err != nil {
+			logger.Err(err)
+			return
+		}
+		logger.Info("imported", imported, "entries")
+	case "purge":
+		purged, err := memory.Purge("", "", "")
+		if err != nil {
+			logger.Err(err)
+			return
+		}
+		logger.Info("purged", purged, "entries")
+	default:
+		logger.Err(fmt.Errorf("unknown memory command '%s'", cfg.MemoryCmd))
+	}
+}
@@ -0,0 +1,242 @@
+package transub
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BilingualCfg keeps the original text along with the translation on the
+// same cue. SRT, VTT, MicroDVD, SubViewer and TTML get both texts stacked,
+// SSA and ASS get the original as an extra dialogue on a top placed style
+type BilingualCfg struct {
+	// Enabled turns the bilingual output on
+	Enabled bool
+	// OriginalFirst stacks the original above the translation
+	OriginalFirst bool
+	// Italic writes the original in italics
+	Italic bool
+	// Color of the original, eg: "#ffff00". Empty keeps the player default
+	Color string
+}
+
+const bilingualStyle = "Original"
+
+var (
+	hexColorRe = regexp.MustCompile(`^#?([0-9a-fA-F]{2})([0-9a-fA-F]{2})([0-9a-fA-F]{2})$`)
+	// a single positioning override inside a {...} block
+	ssaPositionOverrideRe = regexp.MustCompile(`\\(an?\d+|(pos|move|org)\([^)]*\))`)
+)
+
+func WithBilingual(cfg BilingualCfg) func(*Options) {
+	return func(opt *Options) {
+		opt.Bilingual = cfg
+	}
+}
+
+// originalCopy keeps the cue texts as they are before translation. Cues and
+// the TTML tree are copied, not the rest of the document
+func (doc *Document) originalCopy() *Document {
+	original := *doc
+	// TTML cues point into the xml tree, each copy gets its own
+	var nodes map[*ttmlNode]*ttmlNode
+	if doc.xmlRoot != nil {
+		nodes = map[*ttmlNode]*ttmlNode{}
+		original.xmlRoot = doc.xmlRoot.copy(nodes)
+	}
+	original.Cues = make([]*Cue, len(doc.Cues))
+	for i, cue := range doc.Cues {
+		original.Cues[i] = cue.copy()
+		if cue.node != nil && nodes != nil {
+			original.Cues[i].node = nodes[cue.node]
+		}
+	}
+	return &original
+}
+
+func (cue *Cue) copy() *Cue {
+	cueCopy := *cue
+	cueCopy.Lines = append([]string{}, cue.Lines...)
+	cueCopy.Meta = map[string]string{}
+	for key, val := range cue.Meta {
+		cueCopy.Meta[key] = val
+	}
+	return &cueCopy
+}
+
+// mergeBilingual adds the original texts to the translated doc. Both
+// documents must have the same cues, in the same format
+func (doc *Document) mergeBilingual(original *Document, cfg BilingualCfg) {
+	if len(doc.Cues) != len(original.Cues) {
+		log.Printf("[bilingual] %d translated cues for %d originals, keeping the translation only", len(doc.Cues), len(original.Cues))
+		return
+	}
+	if doc.Format == FormatSSA || doc.Format == FormatASS {
+		doc.mergeBilingualSSA(original, cfg)
+		return
+	}
+
+	if doc.Format == FormatVTT && len(cfg.Color) > 0 {
+		if matches := hexColorRe.FindStringSubmatch(cfg.Color); matches != nil {
+			doc.Header = append(doc.Header, "", "STYLE", "::cue(.original) {",
+				fmt.Sprintf("  color: #%s%s%s;", matches[1], matches[2], matches[3]), "}")
+		}
+	}
+	for i, cue := range doc.Cues {
+		origCue := original.Cues[i]
+		if cue.Meta[metaRaw] == "true" || cue.Text() == origCue.Text() || len(origCue.Lines) == 0 {
+			continue
+		}
+
+		// the {\anN} positioning goes to the first line of the stack
+		position := ""
+		origLines := append([]string{}, origCue.Lines...)
+		if doc.Format == FormatSRT {
+			if loc := srtAlignRe.FindStringIndex(cue.Lines[0]); loc != nil && loc[0] == 0 {
+				position = cue.Lines[0][:loc[1]]
+				cue.Lines[0] = cue.Lines[0][loc[1]:]
+			}
+			origLines[0] = srtAlignRe.ReplaceAllString(origLines[0], "")
+		}
+		for j, line := range origLines {
+			origLines[j] = styleOriginalLine(line, doc.Format, cfg)
+		}
+
+		if cfg.OriginalFirst {
+			cue.Lines = append(origLines, cue.Lines...)
+		} else {
+			cue.Lines = append(cue.Lines, origLines...)
+		}
+		cue.Lines[0] = position + cue.Lines[0]
+	}
+}
+
+func styleOriginalLine(line string, format Format, cfg BilingualCfg) string {
+	color := hexColorRe.FindStringSubmatch(cfg.Color)
+	switch format {
+	case FormatSRT:
+		if cfg.Italic {
+			line = "<i>" + line + "</i>"
+		}
+		if color != nil {
+			line = fmt.Sprintf(`<font color="#%s%s%s">%s</font>`, color[1], color[2], color[3], line)
+		}
+	case FormatVTT:
+		if cfg.Italic {
+			line = "<i>" + line + "</i>"
+		}
+		if color != nil {
+			line = "<c.original>" + line + "</c>"
+		}
+	case FormatMicroDVD:
+		if color != nil {
+			line = fmt.Sprintf("{c:$%s%s%s}", color[3], color[2], color[1]) + line
+		}
+		if cfg.Italic {
+			line = "{y:i}" + line
+		}
+	}
+	return line
+}
+
+// mergeBilingualSSA adds an "Original" style, a top placed copy of the
+// Default one, and a dialogue using it after each translated dialogue
+func (doc *Document) mergeBilingualSSA(original *Document, cfg BilingualCfg) {
+	style := doc.addBilingualStyle(cfg)
+
+	var cues []*Cue
+	for i, cue := range doc.Cues {
+		kind := cue.Meta[metaKind]
+		isDialogue := cue.Meta[metaRaw] != "true" && (len(kind) == 0 || kind == ssaDialogueKind)
+		if !isDialogue || cue.Text() == original.Cues[i].Text() {
+			cues = append(cues, cue)
+			continue
+		}
+		origCue := original.Cues[i].copy()
+		origCue.Meta["Style"] = style
+		for j, line := range origCue.Lines {
+			// positioning would move the original over the translation
+			line = ssaPositionOverrideRe.ReplaceAllString(line, "")
+			origCue.Lines[j] = strings.ReplaceAll(line, "{}", "")
+		}
+		if cfg.OriginalFirst {
+			cues = append(cues, origCue, cue)
+		} else {
+			cues = append(cues, cue, origCue)
+		}
+	}
+	doc.Cues = cues
+}
+
+// addBilingualStyle writes the "Original" style line on the header, right
+// after the last style, and returns its name
+func (doc *Document) addBilingualStyle(cfg BilingualCfg) string {
+	formatIdx, lastStyleIdx := -1, -1
+	isASS := false
+	section := ""
+	for i, line := range doc.Header {
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(line)
+			continue
+		}
+		if section != ssaParserStylesStr && section != ssaParserV4StylesStr {
+			continue
+		}
+		isASS = section == ssaParserStylesStr
+		if constCompare(line, "format:") {
+			formatIdx = i
+		}
+		if constCompare(line, "style:") {
+			lastStyleIdx = i
+		}
+	}
+	if formatIdx < 0 || lastStyleIdx < 0 {
+		log.Println("[bilingual] no styles section found, the original keeps the default style")
+		return "Default"
+	}
+
+	base, ok := doc.Styles["Default"]
+	if !ok {
+		_, value, _ := strings.Cut(doc.Header[lastStyleIdx], ":")
+		_, fieldsStr, _ := strings.Cut(doc.Header[formatIdx], ":")
+		base = map[string]string{}
+		fields := splitSSAFields(fieldsStr, -1)
+		for i, val := range splitSSAFields(strings.TrimSpace(value), len(fields)) {
+			base[fields[i]] = val
+		}
+	}
+	style := map[string]string{}
+	for key, val := range base {
+		style[key] = val
+	}
+	style["Name"] = bilingualStyle
+	style["Alignment"] = "8"
+	if !isASS {
+		style["Alignment"] = strconv.Itoa(ssaNumpadToLegacy[8])
+	}
+	if cfg.Italic {
+		style["Italic"] = "-1"
+	}
+	if color := hexColorRe.FindStringSubmatch(cfg.Color); color != nil {
+		// &HAABBGGRR on ASS, a BGR long integer on SSA
+		style["PrimaryColour"] = strings.ToUpper(fmt.Sprintf("&H00%s%s%s", color[3], color[2], color[1]))
+		if !isASS {
+			bgr, _ := strconv.ParseInt(color[3]+color[2]+color[1], 16, 64)
+			style["PrimaryColour"] = strconv.FormatInt(bgr, 10)
+		}
+	}
+	doc.Styles[bilingualStyle] = style
+
+	_, fieldsStr, _ := strings.Cut(doc.Header[formatIdx], ":")
+	var values []string
+	for _, field := range splitSSAFields(fieldsStr, -1) {
+		values = append(values, style[field])
+	}
+	styleLine := "Style: " + strings.Join(values, ",")
+	header := append([]string{}, doc.Header[:lastStyleIdx+1]...)
+	header = append(header, styleLine)
+	doc.Header = append(header, doc.Header[lastStyleIdx+1:]...)
+	return bilingualStyle
+}
@@ -0,0 +1,66 @@
+package transub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocument_mergeBilingual_SRT(t *testing.T) {
+	doc, err := ParseDocument(strings.Split(`1
+00:00:01,000 --> 00:00:02,000
+{\an8}Wait!
+
+2
+00:00:03,000 --> 00:00:04,000
+♪ ♪
+`, "\n"), FormatSRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := doc.originalCopy()
+	doc.Cues[0].Lines = []string{`{\an8}Espera!`}
+
+	doc.mergeBilingual(original, BilingualCfg{Enabled: true, OriginalFirst: true, Italic: true, Color: "#ffff00"})
+	want := `1
+00:00:01,000 --> 00:00:02,000
+{\an8}<font color="#ffff00"><i>Wait!</i></font>
+Espera!
+
+2
+00:00:03,000 --> 00:00:04,000
+♪ ♪
+`
+	if got := strings.Join(doc.Lines(), "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDocument_mergeBilingual_ASS(t *testing.T) {
+	doc, err := ParseDocument(strings.Split(`[Script Info]
+ScriptType: v4.00+
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, Italic, Alignment
+Style: Default,Arial,48,&H00FFFFFF,0,2
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\pos(10,10)\i1}Hello{\i0}`, "\n"), FormatASS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := doc.originalCopy()
+	doc.Cues[0].Lines = []string{`{\pos(10,10)\i1}Olá{\i0}`}
+
+	doc.mergeBilingual(original, BilingualCfg{Enabled: true, Italic: true, Color: "#00ff80"})
+	got := strings.Join(doc.Lines(), "\n")
+	for _, want := range []string{
+		"Style: Default,Arial,48,&H00FFFFFF,0,2\nStyle: Original,Arial,48,&H0080FF00,-1,8\n",
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\\pos(10,10)\\i1}Olá{\\i0}\n" +
+			"Dialogue: 0,0:00:01.00,0:00:02.00,Original,,0,0,0,,{\\i1}Hello{\\i0}",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output is missing %q:\n%s", want, got)
+		}
+	}
+}
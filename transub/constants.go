@@ -3,14 +3,55 @@ package transub
 import "os"
 
 const (
-	LN_BREAK                      = "\n"
-	LN_SEP                        = " /// "
-	META_TRASNLATED               = "meta=translated"
-	gtransCharLimit               = 5_000
-	fileEditFlag                  = os.O_APPEND | os.O_CREATE | os.O_WRONLY
-	textPlainMIME                 = "text/plain"
-	ssaParserEvtsStr              = "[events]"
-	ssaParserFormatStr            = "format:"
-	ssaParserDialogueStr          = "dialogue:"
-	ssaParserUnknFormat  formatOK = -1
+	LN_BREAK             = "\n"
+	LN_SEP               = " /// "
+	META_TRASNLATED      = "meta=translated"
+	gtransCharLimit      = 5_000
+	fileEditFlag         = os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	textPlainMIME        = "text/plain"
+	textXMLMIME          = "text/xml"
+	ssaParserEvtsStr     = "[events]"
+	ssaParserFormatStr   = "format:"
+	ssaParserInfoStr     = "[script info]"
+	ssaParserStylesStr   = "[v4+ styles]"
+	ssaParserV4StylesStr = "[v4 styles]"
+	ssaInfoPrefix        = "info."
+	ssaParserDialogueStr = "dialogue:"
+	metaKind             = "kind"
+	metaFormat           = "format"
+	metaSettings         = "settings"
+	metaTranslatable     = "translatable"
+	metaID               = "id"
+	metaRaw              = "raw"
+	vttSignature         = "WEBVTT"
+	metaFPS              = "fps"
+	metaFPSHeader        = "fps.header"
+	metaStartFrame       = "frame.start"
+	metaEndFrame         = "frame.end"
+	subViewerInfoStr     = "[information]"
+	subViewerBreak       = "[br]"
+	metaOffset           = "offset"
+	metaOriginal         = "original"
+	metaAlign            = "align"
+	ssaDialogueKind      = "Dialogue"
+)
+
+const (
+	BackendGoogle         = "google"
+	BackendLibreTranslate = "libretranslate"
+	BackendDeepL          = "deepl"
+	BackendLLM            = "llm"
+	BackendCustom         = "custom"
+	libreDefaultURL       = "http://localhost:5000"
+	deeplFreeURL          = "https://api-free.deepl.com"
+	deeplProURL           = "https://api.deepl.com"
+	deeplAuthKeyEnv       = "DEEPL_AUTH_KEY"
+	// DeepL accepts up to 128 KiB per request, keep some room for the json payload
+	deeplCharLimit = 120_000
+	// Ollama default address, any OpenAI compatible api works
+	llmDefaultURL   = "http://localhost:11434/v1"
+	llmDefaultModel = "llama3"
+	llmAPIKeyEnv    = "OPENAI_API_KEY"
+	// small batches keeps the model focused and the json answer short
+	llmCharLimit = 2_000
 )
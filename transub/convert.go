@@ -0,0 +1,541 @@
+package transub
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// basic styling shared by every format on conversion
+	neutralTagRe       = regexp.MustCompile(`</?[ibu]>`)
+	anyTagRe           = regexp.MustCompile(`<[^>]*>`)
+	srtAlignRe         = regexp.MustCompile(`\{\\an?(\d+)\}`)
+	ssaOverrideRe      = regexp.MustCompile(`\\(an|a|i|b|u|pos)(\([^)]*\)|\d+)?`)
+	microDVDStyleRe    = regexp.MustCompile(`\{([yY]):([^}]*)\}`)
+	vttLineSettingRe   = regexp.MustCompile(`line:(-?\d+(?:\.\d+)?)(%?)`)
+	ttmlRegionOriginRe = regexp.MustCompile(`\s*(\d+(?:\.\d+)?)%\s+(\d+(?:\.\d+)?)%`)
+)
+
+// ssa v4 legacy \a alignment to numpad (\an) alignment and back
+var (
+	ssaLegacyToNumpad = map[int]int{1: 1, 2: 2, 3: 3, 5: 7, 6: 8, 7: 9, 9: 4, 10: 5, 11: 6}
+	ssaNumpadToLegacy = map[int]int{1: 1, 2: 2, 3: 3, 7: 5, 8: 6, 9: 7, 4: 9, 5: 10, 6: 11}
+)
+
+const alignBottom = 2
+
+// FormatExt returns the file extension used by format
+func FormatExt(format Format) string {
+	switch format {
+	case FormatMicroDVD, FormatSubViewer:
+		return ".sub"
+	}
+	return "." + string(format)
+}
+
+// Convert maps the cues of doc to a new document on another format. Timings
+// and line breaks are kept, styling is reduced to italic, bold, underline
+// and the cue position. Comments and notes are dropped
+func Convert(doc *Document, format Format) (*Document, error) {
+	if extFormat, ok := FormatFromExt(string(format)); ok {
+		format = extFormat
+	}
+	if _, ok := FormatFromExt(FormatExt(format)); !ok {
+		return nil, fmt.Errorf("[transub] unsupported subtitle format '%s'", format)
+	}
+
+	converted := &Document{Format: format, Meta: map[string]string{}, Styles: map[string]map[string]string{}}
+	for _, cue := range doc.Cues {
+		kind := cue.Meta[metaKind]
+		if cue.Meta[metaRaw] == "true" || (len(kind) > 0 && kind != ssaDialogueKind) {
+			continue
+		}
+		lines, align := doc.neutralLines(cue)
+		converted.Cues = append(converted.Cues, &Cue{
+			Index: len(converted.Cues) + 1,
+			Start: cue.Start,
+			End:   cue.End,
+			Lines: lines,
+			Meta:  map[string]string{metaAlign: strconv.Itoa(align)},
+		})
+	}
+
+	switch format {
+	case FormatSRT:
+		for _, cue := range converted.Cues {
+			if align := cueAlign(cue); align != alignBottom && len(cue.Lines) > 0 {
+				cue.Lines[0] = fmt.Sprintf("{\\an%d}", align) + cue.Lines[0]
+			}
+		}
+	case FormatVTT:
+		converted.Header = []string{vttSignature}
+		for _, cue := range converted.Cues {
+			if align := cueAlign(cue); align >= 7 {
+				cue.Meta[metaSettings] = "line:0"
+			}
+		}
+	case FormatSSA, FormatASS:
+		converted.toSSA(doc.Meta[ssaInfoPrefix+"Title"])
+	case FormatMicroDVD:
+		fps := doc.Meta[metaFPS]
+		if len(fps) == 0 {
+			fps = strconv.FormatFloat(microDVDDefaultFPS, 'f', -1, 64)
+		}
+		converted.Meta[metaFPS] = fps
+		converted.Meta[metaFPSHeader] = "true"
+		for _, cue := range converted.Cues {
+			for i, line := range cue.Lines {
+				if strings.HasPrefix(line, "<i>") && strings.HasSuffix(line, "</i>") {
+					line = "{y:i}" + strings.TrimSuffix(strings.TrimPrefix(line, "<i>"), "</i>")
+				}
+				cue.Lines[i] = anyTagRe.ReplaceAllString(line, "")
+			}
+		}
+	case FormatSubViewer:
+		converted.Header = strings.Split(subViewerTemplate, LN_BREAK)
+		for _, cue := range converted.Cues {
+			for i, line := range cue.Lines {
+				cue.Lines[i] = anyTagRe.ReplaceAllString(line, "")
+			}
+		}
+	case FormatTTML, FormatDFXP:
+		ttmlDoc, err := ParseDocument(strings.Split(converted.ttmlString(), LN_BREAK), format)
+		if err != nil {
+			return nil, err
+		}
+		return ttmlDoc, nil
+	}
+
+	return converted, nil
+}
+
+// ConvertFile writes a copy of filename on another format, next to it.
+// WithTiming options retime it too, an empty format then keeps the source
+// one and the copy is named file.retimed.ext
+func ConvertFile(filename string, format Format, options ...withOptions) (string, error) {
+	srcFormat, ok := FormatFromFilename(filename)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotSubtitle, filename)
+	}
+	var convOpts Options
+	for _, optFn := range options {
+		optFn(&convOpts)
+	}
+	fileLines, enc, err := readTextFile(filename)
+	if err != nil {
+		return "", err
+	}
+	doc, err := ParseDocument(fileLines, srcFormat)
+	if err != nil {
+		return "", err
+	}
+	if err = doc.ApplyTiming(convOpts.Timing); err != nil {
+		return "", err
+	}
+	converted := doc
+	if len(format) == 0 {
+		format = doc.Format
+	}
+	if extFormat, ok := FormatFromExt(string(format)); ok {
+		format = extFormat
+	}
+	if format != doc.Format {
+		if converted, err = Convert(doc, format); err != nil {
+			return "", err
+		}
+	}
+
+	// the extension may be in any case, eg: movie.SRT
+	stem := removeFileExtension(filename, filepath.Ext(filename))
+	output := stem + FormatExt(format)
+	if strings.EqualFold(output, filename) && !convOpts.Timing.isZero() {
+		output = stem + ".retimed" + FormatExt(format)
+	}
+	if strings.EqualFold(output, filename) {
+		return "", fmt.Errorf("[transub] %s is already a %s file", filename, format)
+	}
+	if _, err := os.Stat(output); err == nil {
+		return "", fmt.Errorf("%w: %s", ErrOutputExists, output)
+	}
+	data, err := encodeLines(converted.Lines(), textEncoding{encoding: EncodingUTF8, lineBreak: enc.lineBreak})
+	if err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(output, data, 0666); err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+func cueAlign(cue *Cue) int {
+	align, err := strconv.Atoi(cue.Meta[metaAlign])
+	if err != nil || align < 1 || align > 9 {
+		return alignBottom
+	}
+	return align
+}
+
+// neutralLines returns the cue lines with its markup reduced to <i>, <b>
+// and <u> tags, along with the numpad alignment of the cue (2 is bottom center)
+func (doc *Document) neutralLines(cue *Cue) ([]string, int) {
+	align := alignBottom
+	lines := make([]string, 0, len(cue.Lines))
+
+	switch doc.Format {
+	case FormatSRT, FormatVTT:
+		if matches := vttLineSettingRe.FindStringSubmatch(cue.Meta[metaSettings]); matches != nil {
+			line, _ := strconv.ParseFloat(matches[1], 64)
+			if (matches[2] == "%" && line < 50) || (matches[2] == "" && line >= 0) {
+				align = 8
+			}
+		}
+		for _, line := range cue.Lines {
+			if matches := srtAlignRe.FindStringSubmatch(line); matches != nil {
+				align, _ = strconv.Atoi(matches[1])
+				if strings.HasPrefix(matches[0], "{\\a") && !strings.HasPrefix(matches[0], "{\\an") {
+					align = ssaLegacyToNumpad[align]
+				}
+			}
+			line = srtAlignRe.ReplaceAllString(line, "")
+			line = ssaTagRe.ReplaceAllString(line, "")
+			lines = append(lines, keepNeutralTags(line))
+		}
+
+	case FormatSSA, FormatASS:
+		style := doc.Styles[cue.Meta["Style"]]
+		if alignment, err := strconv.Atoi(style["Alignment"]); err == nil {
+			align = alignment
+			if doc.Format == FormatSSA {
+				align = ssaLegacyToNumpad[alignment]
+			}
+		}
+		playResY, err := strconv.ParseFloat(doc.Meta[ssaInfoPrefix+"PlayResY"], 64)
+		if err != nil || playResY <= 0 {
+			playResY = 288
+		}
+		for _, line := range cue.Lines {
+			line = ssaTagRe.ReplaceAllStringFunc(line, func(block string) string {
+				if block == "\\n" || block == "\\h" {
+					return " "
+				}
+				var tags string
+				for _, override := range ssaOverrideRe.FindAllStringSubmatch(block, -1) {
+					switch tag, val := override[1], strings.Trim(override[2], "()"); tag {
+					case "an":
+						align, _ = strconv.Atoi(val)
+					case "a":
+						legacy, _ := strconv.Atoi(val)
+						align = ssaLegacyToNumpad[legacy]
+					case "pos":
+						coords := strings.Split(val, ",")
+						if y, err := strconv.ParseFloat(strings.TrimSpace(coords[len(coords)-1]), 64); err == nil {
+							align = alignBottom
+							if y < playResY/2 {
+								align = 8
+							}
+						}
+					case "i", "b", "u":
+						if val == "0" {
+							tags += "</" + tag + ">"
+						} else if len(val) > 0 {
+							tags += "<" + tag + ">"
+						}
+					}
+				}
+				return tags
+			})
+			lines = append(lines, wrapStyle(line, style["Italic"], style["Bold"], style["Underline"]))
+		}
+
+	case FormatMicroDVD:
+		var cueStyles string
+		for _, line := range cue.Lines {
+			lineStyles := ""
+			line = microDVDStyleRe.ReplaceAllStringFunc(line, func(code string) string {
+				matches := microDVDStyleRe.FindStringSubmatch(code)
+				if matches[1] == "Y" {
+					cueStyles += matches[2]
+				} else {
+					lineStyles += matches[2]
+				}
+				return ""
+			})
+			line = microDVDTagRe.ReplaceAllString(line, "")
+			styles := cueStyles + lineStyles
+			lines = append(lines, wrapStyle(line,
+				strconv.FormatBool(strings.Contains(styles, "i")),
+				strconv.FormatBool(strings.Contains(styles, "b")),
+				strconv.FormatBool(strings.Contains(styles, "u")),
+			))
+		}
+
+	case FormatTTML, FormatDFXP:
+		pStyle := doc.ttmlStyle(cue.Meta["style"], nil)
+		region := doc.Styles[cue.Meta["region"]]
+		if matches := ttmlRegionOriginRe.FindStringSubmatch(region["tts:origin"]); matches != nil {
+			if y, _ := strconv.ParseFloat(matches[2], 64); y < 50 {
+				align = 8
+			}
+		}
+		if region["tts:displayAlign"] == "before" {
+			align = 8
+		}
+		for _, line := range cue.Lines {
+			text := doc.ttmlNeutralText(line)
+			lines = append(lines, wrapStyle(text, pStyle["italic"], pStyle["bold"], pStyle["underline"]))
+		}
+
+	default:
+		for _, line := range cue.Lines {
+			lines = append(lines, keepNeutralTags(line))
+		}
+	}
+
+	return lines, align
+}
+
+// keepNeutralTags removes any tag that is not <i>, <b> or <u>
+func keepNeutralTags(line string) string {
+	return anyTagRe.ReplaceAllStringFunc(line, func(tag string) string {
+		if neutralTagRe.MatchString(tag) {
+			return tag
+		}
+		return ""
+	})
+}
+
+func wrapStyle(line, italic, bold, underline string) string {
+	isOn := func(val string) bool {
+		return val == "-1" || val == "1" || val == "true"
+	}
+	for _, style := range []struct {
+		on  bool
+		tag string
+	}{{isOn(underline), "u"}, {isOn(bold), "b"}, {isOn(italic), "i"}} {
+		if style.on && len(line) > 0 {
+			line = "<" + style.tag + ">" + line + "</" + style.tag + ">"
+		}
+	}
+	return line
+}
+
+// ttmlStyle resolves the italic, bold and underline flags of a TTML style
+// attribute (that may reference many styles) and inline tts attributes
+func (doc *Document) ttmlStyle(styleRefs string, attrs []xml.Attr) map[string]string {
+	flags := map[string]string{}
+	apply := func(name, value string) {
+		switch {
+		case strings.HasSuffix(name, "fontStyle"):
+			flags["italic"] = strconv.FormatBool(value == "italic" || value == "oblique")
+		case strings.HasSuffix(name, "fontWeight"):
+			flags["bold"] = strconv.FormatBool(value == "bold")
+		case strings.HasSuffix(name, "textDecoration"):
+			flags["underline"] = strconv.FormatBool(strings.Contains(value, "underline") && !strings.Contains(value, "noUnderline"))
+		}
+	}
+	for _, ref := range strings.Fields(styleRefs) {
+		for name, value := range doc.Styles[ref] {
+			apply(name, value)
+		}
+	}
+	for _, attr := range attrs {
+		if attr.Name.Local == "style" {
+			for k, v := range doc.ttmlStyle(attr.Value, nil) {
+				flags[k] = v
+			}
+			continue
+		}
+		apply(attr.Name.Local, attr.Value)
+	}
+	return flags
+}
+
+func (doc *Document) ttmlNeutralText(fragment string) string {
+	decoder := xml.NewDecoder(strings.NewReader("<fragment>" + fragment + "</fragment>"))
+	var sb strings.Builder
+	var closers []string
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return html.UnescapeString(anyTagRe.ReplaceAllString(fragment, ""))
+		}
+		switch tk := token.(type) {
+		case xml.StartElement:
+			if tk.Name.Local != "span" {
+				continue
+			}
+			flags := doc.ttmlStyle("", tk.Attr)
+			closer := ""
+			for _, style := range []struct{ flag, tag string }{{"italic", "i"}, {"bold", "b"}, {"underline", "u"}} {
+				if flags[style.flag] == "true" {
+					sb.WriteString("<" + style.tag + ">")
+					closer = "</" + style.tag + ">" + closer
+				}
+			}
+			closers = append(closers, closer)
+		case xml.EndElement:
+			if tk.Name.Local != "span" || len(closers) == 0 {
+				continue
+			}
+			sb.WriteString(closers[len(closers)-1])
+			closers = closers[:len(closers)-1]
+		case xml.CharData:
+			sb.WriteString(string(tk))
+		}
+	}
+	return sb.String()
+}
+
+func (doc *Document) toSSA(title string) {
+	isASS := doc.Format == FormatASS
+	template := ssaTemplate
+	fields := ssaV4DefaultFields
+	if isASS {
+		template = assTemplate
+		fields = ssaDefaultFields
+	}
+	doc.Header = strings.Split(fmt.Sprintf(template, title), LN_BREAK)
+	doc.Meta[metaFormat] = strings.Join(fields, ",")
+
+	ssaTags := strings.NewReplacer("<i>", "{\\i1}", "</i>", "{\\i0}", "<b>", "{\\b1}", "</b>", "{\\b0}", "<u>", "{\\u1}", "</u>", "{\\u0}")
+	for _, cue := range doc.Cues {
+		for _, field := range fields {
+			cue.Meta[field] = "0"
+		}
+		cue.Meta[metaKind] = ssaDialogueKind
+		cue.Meta["Style"] = "Default"
+		cue.Meta["Name"] = ""
+		cue.Meta["Effect"] = ""
+		if !isASS {
+			cue.Meta["Marked"] = "Marked=0"
+		}
+		for i, line := range cue.Lines {
+			cue.Lines[i] = ssaTags.Replace(line)
+		}
+		if align := cueAlign(cue); align != alignBottom && len(cue.Lines) > 0 {
+			override := fmt.Sprintf("{\\an%d}", align)
+			if !isASS {
+				override = fmt.Sprintf("{\\a%d}", ssaNumpadToLegacy[align])
+			}
+			cue.Lines[0] = override + cue.Lines[0]
+		}
+	}
+}
+
+func (doc *Document) ttmlString() string {
+	var sb strings.Builder
+	sb.WriteString(ttmlTemplate)
+	for _, cue := range doc.Cues {
+		region := ""
+		if cueAlign(cue) >= 7 {
+			region = ` region="top"`
+		}
+		var lines []string
+		for _, line := range balanceTags(cue.Lines) {
+			line = ttmlEscape(line, false)
+			line = strings.NewReplacer(
+				"&lt;i&gt;", `<span tts:fontStyle="italic">`,
+				"&lt;b&gt;", `<span tts:fontWeight="bold">`,
+				"&lt;u&gt;", `<span tts:textDecoration="underline">`,
+				"&lt;/i&gt;", "</span>", "&lt;/b&gt;", "</span>", "&lt;/u&gt;", "</span>",
+			).Replace(line)
+			lines = append(lines, line)
+		}
+		sb.WriteString(fmt.Sprintf(
+			"<p begin=\"%s\" end=\"%s\"%s>%s</p>\n",
+			formatVTTTimestamp(cue.Start), formatVTTTimestamp(cue.End), region, strings.Join(lines, "<br/>"),
+		))
+	}
+	sb.WriteString("</div>\n</body>\n</tt>")
+	return sb.String()
+}
+
+// balanceTags closes the tags left open at the end of each line and
+// reopens them on the next one, so a line never depends on another
+func balanceTags(lines []string) []string {
+	var open []string
+	balanced := make([]string, len(lines))
+	for i, line := range lines {
+		prefix := strings.Join(open, "")
+		for _, tag := range neutralTagRe.FindAllString(line, -1) {
+			if strings.HasPrefix(tag, "</") {
+				for j := len(open) - 1; j >= 0; j-- {
+					if open[j] == strings.Replace(tag, "/", "", 1) {
+						open = append(open[:j], open[j+1:]...)
+						break
+					}
+				}
+				continue
+			}
+			open = append(open, tag)
+		}
+		suffix := ""
+		for j := len(open) - 1; j >= 0; j-- {
+			suffix += strings.Replace(open[j], "<", "</", 1)
+		}
+		balanced[i] = prefix + line + suffix
+	}
+	return balanced
+}
+
+const (
+	assTemplate = `[Script Info]
+Title: %s
+ScriptType: v4.00+
+WrapStyle: 0
+PlayResX: 384
+PlayResY: 288
+ScaledBorderAndShadow: yes
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Arial,20,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,2,2,10,10,10,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text`
+	ssaTemplate = `[Script Info]
+Title: %s
+ScriptType: v4.00
+PlayResX: 384
+PlayResY: 288
+
+[V4 Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, TertiaryColour, BackColour, Bold, Italic, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, AlphaLevel, Encoding
+Style: Default,Arial,20,16777215,65535,65535,0,0,0,1,2,2,2,10,10,10,0,1
+
+[Events]
+Format: Marked, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text`
+	subViewerTemplate = `[INFORMATION]
+[TITLE]
+[AUTHOR]
+[SOURCE]
+[PRG]
+[FILEPATH]
+[DELAY]0
+[CD TRACK]0
+[COMMENT]
+[END INFORMATION]
+[SUBTITLE]
+[COLF]&HFFFFFF,[STYLE]no,[SIZE]18,[FONT]Arial`
+	ttmlTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling">
+<head>
+<layout>
+<region xml:id="bottom" tts:origin="10% 80%" tts:extent="80% 15%" tts:textAlign="center" tts:displayAlign="after"/>
+<region xml:id="top" tts:origin="10% 5%" tts:extent="80% 15%" tts:textAlign="center" tts:displayAlign="before"/>
+</layout>
+</head>
+<body region="bottom">
+<div>
+`
+)
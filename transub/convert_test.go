@@ -0,0 +1,125 @@
+package transub
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvert(t *testing.T) {
+	srt := strings.Split(`1
+00:00:01,000 --> 00:00:02,500
+{\an8}<i>Hello</i> <b>world</b>
+
+2
+00:00:03,000 --> 00:00:04,000
+<i>First line
+second line</i>
+`, "\n")
+	doc, err := ParseDocument(srt, FormatSRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format Format
+		wants  []string
+	}{
+		{FormatASS, []string{
+			`Dialogue: 0,0:00:01.00,0:00:02.50,Default,,0,0,0,,{\an8}{\i1}Hello{\i0} {\b1}world{\b0}`,
+			`Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\i1}First line\Nsecond line{\i0}`,
+		}},
+		{FormatSSA, []string{`Dialogue: Marked=0,0:00:01.00,0:00:02.50,Default,,0,0,0,,{\a6}{\i1}Hello`}},
+		{FormatVTT, []string{"00:00:01.000 --> 00:00:02.500 line:0\n<i>Hello</i> <b>world</b>"}},
+		{FormatTTML, []string{
+			`<p begin="00:00:01.000" end="00:00:02.500" region="top"><span tts:fontStyle="italic">Hello</span> <span tts:fontWeight="bold">world</span></p>`,
+			`<span tts:fontStyle="italic">First line</span><br/><span tts:fontStyle="italic">second line</span>`,
+		}},
+		{FormatMicroDVD, []string{"{1}{1}23.976", "{24}{60}Hello world", "{72}{96}First line|second line"}},
+		{"sub", []string{"{24}{60}Hello world"}},
+	}
+	for _, tt := range tests {
+		converted, err := Convert(doc, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Join(converted.Lines(), "\n")
+		for _, want := range tt.wants {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s output is missing %q:\n%s", tt.format, want, got)
+			}
+		}
+	}
+}
+
+func TestConvert_ASSToSRT(t *testing.T) {
+	ass := strings.Split(`[Script Info]
+ScriptType: v4.00+
+PlayResY: 720
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, Bold, Italic, Alignment
+Style: Default,Arial,48,0,0,2
+Style: Thoughts,Arial,48,0,-1,2
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Comment: 0,0:00:00.00,0:00:01.00,Default,,0,0,0,,note
+Dialogue: 0,0:00:01.00,0:00:02.00,Thoughts,,0,0,0,,Why?\NWhy me?
+Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\pos(640,40)\b1}Sign{\b0}`, "\n")
+	doc, err := ParseDocument(ass, FormatASS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, err := Convert(doc, FormatSRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `1
+00:00:01,000 --> 00:00:02,000
+<i>Why?</i>
+<i>Why me?</i>
+
+2
+00:00:03,000 --> 00:00:04,000
+{\an8}<b>Sign</b>
+`
+	if got := strings.Join(converted.Lines(), "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConvertFile_ExtensionCase(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("examples", "subtitle.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		format  Format
+		options []withOptions
+		want    string
+	}{
+		{"movie.SRT", FormatVTT, nil, "movie.vtt"},
+		{"show.Srt", "", []withOptions{WithTiming(TimingCfg{Shift: time.Second})}, "show.retimed.srt"},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(filename, data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		output, err := ConvertFile(filename, tt.format, tt.options...)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if want := filepath.Join(dir, tt.want); output != want {
+			t.Errorf("%s: got %s, want %s", tt.name, output, want)
+		}
+		if _, err := os.Stat(output); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package transub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type DeepLCfg struct {
+	AuthKey string
+	// URL overrides the endpoint guessed from the auth key (free keys ends with ":fx")
+	URL string
+	// Formality: default, more, less, prefer_more or prefer_less
+	Formality string
+	// Glossaries maps a "src-dest" language pair (eg: "en-pt") to a DeepL glossary id
+	Glossaries map[string]string
+}
+
+type deeplTranslator struct {
+	cfg    DeepLCfg
+	client *http.Client
+}
+
+type deeplReq struct {
+	Text       []string `json:"text"`
+	SourceLang string   `json:"source_lang,omitempty"`
+	TargetLang string   `json:"target_lang"`
+	Formality  string   `json:"formality,omitempty"`
+	GlossaryID string   `json:"glossary_id,omitempty"`
+}
+
+type deeplRes struct {
+	Translations []struct {
+		DetectedSourceLanguage string `json:"detected_source_language"`
+		Text                   string `json:"text"`
+	} `json:"translations"`
+	Message string `json:"message"`
+}
+
+func NewDeepLTranslator(cfg DeepLCfg) Translator {
+	if len(cfg.AuthKey) == 0 {
+		cfg.AuthKey = os.Getenv(deeplAuthKeyEnv)
+	}
+	if len(cfg.URL) == 0 {
+		cfg.URL = deeplProURL
+		if strings.HasSuffix(cfg.AuthKey, ":fx") {
+			cfg.URL = deeplFreeURL
+		}
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &deeplTranslator{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func WithDeepLCfg(cfg DeepLCfg) func(*Options) {
+	return func(opt *Options) {
+		opt.DeepL = cfg
+	}
+}
+
+func (d *deeplTranslator) CharLimit() int {
+	return deeplCharLimit
+}
+
+func (d *deeplTranslator) Translate(text, src, dest string) (string, error) {
+	return d.TranslateContext(context.Background(), text, src, dest)
+}
+
+func (d *deeplTranslator) TranslateContext(ctx context.Context, text, src, dest string) (string, error) {
+	reqBody := deeplReq{
+		Text:       []string{text},
+		TargetLang: deeplTargetLang(dest),
+		Formality:  d.cfg.Formality,
+	}
+	if src != "auto" && len(src) > 0 {
+		reqBody.SourceLang = deeplSourceLang(src)
+		reqBody.GlossaryID = d.cfg.Glossaries[src+"-"+dest]
+	}
+	res, err := d.post(ctx, reqBody)
+	if err != nil {
+		return text, err
+	}
+	return res.Translations[0].Text, nil
+}
+
+func (d *deeplTranslator) DetectLanguage(text string) (string, float64, error) {
+	return d.DetectLanguageContext(context.Background(), text)
+}
+
+func (d *deeplTranslator) DetectLanguageContext(ctx context.Context, text string) (string, float64, error) {
+	// DeepL has no detection endpoint, the source language comes along with any translation
+	res, err := d.post(ctx, deeplReq{Text: []string{text}, TargetLang: "EN-US"})
+	if err != nil {
+		return "", 0, err
+	}
+	lang := strings.ToLower(res.Translations[0].DetectedSourceLanguage)
+	return lang, 1, nil
+}
+
+func (d *deeplTranslator) post(ctx context.Context, reqBody deeplReq) (deeplRes, error) {
+	var res deeplRes
+	if len(d.cfg.AuthKey) == 0 {
+		return res, fmt.Errorf("[deepl] missing auth key. Set it on config or %s env var", deeplAuthKeyEnv)
+	}
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return res, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.URL+"/v2/translate", bytes.NewReader(payload))
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+d.cfg.AuthKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	httpRes, err := d.client.Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer httpRes.Body.Close()
+
+	err = json.NewDecoder(httpRes.Body).Decode(&res)
+	if httpRes.StatusCode != http.StatusOK {
+		if err != nil || len(res.Message) == 0 {
+			return res, fmt.Errorf("[deepl] %s", httpRes.Status)
+		}
+		return res, fmt.Errorf("[deepl] %s: %s", httpRes.Status, res.Message)
+	}
+	if err != nil {
+		return res, fmt.Errorf("[deepl] decode response: %w", err)
+	}
+	if len(res.Translations) == 0 {
+		return res, fmt.Errorf("[deepl] empty translation response")
+	}
+	return res, nil
+}
+
+func deeplSourceLang(lang string) string {
+	base, _, _ := strings.Cut(lang, "-")
+	return strings.ToUpper(base)
+}
+
+func deeplTargetLang(lang string) string {
+	switch strings.ToLower(lang) {
+	case "pt":
+		return "PT-BR"
+	case "en":
+		return "EN-US"
+	case "zh-cn", "zh-tw":
+		return "ZH"
+	}
+	return strings.ToUpper(lang)
+}
@@ -0,0 +1,65 @@
+package transub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeepLTranslator(t *testing.T) {
+	var got deeplReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "DeepL-Auth-Key key:fx" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"translations":[{"detected_source_language":"EN","text":"Olá"}]}`))
+	}))
+	defer srv.Close()
+
+	tr := NewDeepLTranslator(DeepLCfg{
+		AuthKey:    "key:fx",
+		URL:        srv.URL,
+		Formality:  "less",
+		Glossaries: map[string]string{"en-pt": "glossary"},
+	})
+	text, err := tr.Translate("Hello", "en", "pt")
+	if err != nil || text != "Olá" {
+		t.Fatalf("got %q, %v", text, err)
+	}
+	if got.SourceLang != "EN" || got.TargetLang != "PT-BR" || got.Formality != "less" || got.GlossaryID != "glossary" {
+		t.Errorf("unexpected request %+v", got)
+	}
+
+	lang, _, err := tr.DetectLanguage("Hello")
+	if err != nil || lang != "en" {
+		t.Fatalf("got %q, %v", lang, err)
+	}
+	if translationCharLimit(tr) != deeplCharLimit {
+		t.Errorf("deepl should use its own char limit")
+	}
+	if url := NewDeepLTranslator(DeepLCfg{AuthKey: "key:fx"}).(*deeplTranslator).cfg.URL; url != deeplFreeURL {
+		t.Errorf("free key should use %s, got %s", deeplFreeURL, url)
+	}
+}
+
+func TestDeepLTranslator_BadResponse(t *testing.T) {
+	status, body := http.StatusOK, `{"translations":[{"text":"Ol`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	tr := NewDeepLTranslator(DeepLCfg{AuthKey: "key:fx", URL: srv.URL})
+
+	if _, err := tr.Translate("Hello", "en", "pt"); err == nil || !strings.Contains(err.Error(), "decode response") {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+	status, body = http.StatusBadGateway, "<html>Bad Gateway</html>"
+	if _, err := tr.Translate("Hello", "en", "pt"); err == nil || err.Error() != "[deepl] 502 Bad Gateway" {
+		t.Errorf("expected the raw status, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package transub
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatSRT Format = "srt"
+	FormatSSA Format = "ssa"
+	FormatVTT Format = "vtt"
+	FormatASS Format = "ass"
+	// MicroDVD and SubViewer shares the .sub extension
+	FormatMicroDVD  Format = "microdvd"
+	FormatSubViewer Format = "subviewer"
+	// DFXP and IMSC1 are TTML profiles
+	FormatTTML Format = "ttml"
+	FormatDFXP Format = "dfxp"
+)
+
+// Cue is a single subtitle entry. Meta holds the format specific
+// fields (eg: ssa Style, Layer, Effect...)
+type Cue struct {
+	Index int
+	Start time.Duration
+	End   time.Duration
+	Lines []string
+	Meta  map[string]string
+	tags  []lineTags
+	node  *ttmlNode
+}
+
+// Document is a parsed subtitle file. Header keeps everything that comes
+// before the first cue (eg: ssa [Script Info] and [V4 Styles] sections)
+// and Footer everything after the last one. Styles are indexed by name
+// and hold the format specific style fields
+type Document struct {
+	Format Format
+	Header []string
+	Cues   []*Cue
+	Footer []string
+	Meta   map[string]string
+	Styles map[string]map[string]string
+
+	xmlRoot    *ttmlNode
+	ttmlTiming ttmlTiming
+}
+
+func FormatFromExt(ext string) (Format, bool) {
+	format := Format(strings.ToLower(strings.TrimPrefix(ext, ".")))
+	if format == "sub" {
+		return FormatMicroDVD, true
+	}
+	switch format {
+	case FormatSRT, FormatSSA, FormatASS, FormatVTT, FormatTTML, FormatDFXP:
+		return format, true
+	}
+	return "", false
+}
+
+func FormatFromFilename(filename string) (Format, bool) {
+	return FormatFromExt(filepath.Ext(filename))
+}
+
+func ParseDocument(lines []string, format Format) (*Document, error) {
+	var doc *Document
+	var err error
+	if format == FormatMicroDVD || format == FormatSubViewer {
+		format = detectSubFormat(lines)
+	}
+	switch format {
+	case FormatSRT:
+		doc, err = parseSRT(lines)
+	case FormatSSA, FormatASS:
+		doc, err = parseSSA(lines)
+	case FormatVTT:
+		doc, err = parseVTT(lines)
+	case FormatMicroDVD:
+		doc, err = parseMicroDVD(lines)
+	case FormatSubViewer:
+		doc, err = parseSubViewer(lines)
+	case FormatTTML, FormatDFXP:
+		doc, err = parseTTML(lines)
+	default:
+		return nil, fmt.Errorf("[transub] unsupported subtitle format '%s'", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.Format = format
+	return doc, nil
+}
+
+// Lines serializes the document back to its own format
+func (doc *Document) Lines() []string {
+	switch doc.Format {
+	case FormatSRT:
+		return doc.srtLines()
+	case FormatSSA, FormatASS:
+		return doc.ssaLines()
+	case FormatVTT:
+		return doc.vttLines()
+	case FormatMicroDVD:
+		return doc.microDVDLines()
+	case FormatSubViewer:
+		return doc.subViewerLines()
+	case FormatTTML, FormatDFXP:
+		return doc.ttmlLines()
+	}
+	return []string{}
+}
+
+func (cue *Cue) Text() string {
+	return strings.Join(cue.Lines, LN_BREAK)
+}
+
+func (cue *Cue) isTranslatable(removeCC bool) bool {
+	if cue.Meta[metaTranslatable] == "false" {
+		return false
+	}
+	for _, line := range cue.Lines {
+		if Validator.isTranslatableText(line, removeCC) {
+			return true
+		}
+	}
+	return false
+}
+
+func (doc *Document) removeCC() {
+	for _, cue := range doc.Cues {
+		var lines []string
+		for _, line := range cue.Lines {
+			line = Validator.removeCC(line)
+			if len(line) > 0 {
+				lines = append(lines, line)
+			}
+		}
+		cue.Lines = lines
+	}
+}
+
+// tagRe matches the format inline tags, nil when it has none
+func (doc *Document) tagRe() *regexp.Regexp {
+	switch doc.Format {
+	case FormatSRT:
+		return srtTagRe
+	case FormatVTT:
+		return vttTagRe
+	case FormatSSA, FormatASS:
+		return ssaTagRe
+	case FormatMicroDVD:
+		return microDVDTagRe
+	case FormatTTML, FormatDFXP:
+		return ttmlTagRe
+	}
+	return nil
+}
+
+// protectMarkup takes the format inline tags out of the translatable text
+func (doc *Document) protectMarkup() {
+	tagRe := doc.tagRe()
+	if tagRe == nil {
+		return
+	}
+	for _, cue := range doc.Cues {
+		cue.protectTags(tagRe)
+	}
+}
+
+func (doc *Document) restoreMarkup() {
+	for _, cue := range doc.Cues {
+		cue.restoreTags()
+	}
+}
+
+// cueNumber is the number the file shows for the i cue, its 1-based
+// position on formats without numbers
+func (doc *Document) cueNumber(i int) int {
+	if i >= 0 && i < len(doc.Cues) && doc.Cues[i].Index > 0 {
+		return doc.Cues[i].Index
+	}
+	return i + 1
+}
+
+// translatableSegments returns one segment per translatable cue, identified
+// by the cue position on doc.Cues. Multiline cues are joined by LN_SEP
+func (doc *Document) translatableSegments(removeCC bool) []Segment {
+	var segments []Segment
+	for idx, cue := range doc.Cues {
+		if !cue.isTranslatable(removeCC) {
+			continue
+		}
+		text := strings.Join(cue.Lines, LN_SEP)
+		segments = append(segments, Segment{ID: idx, Text: text})
+	}
+	return segments
+}
+
+// mergeTranslatedSegments puts the translations back on their cues, the
+// LN_SEP markers becoming cue lines again
+func (doc *Document) mergeTranslatedSegments(segments []Segment) {
+	for _, seg := range segments {
+		if seg.ID < 0 || seg.ID >= len(doc.Cues) || len(seg.Text) == 0 {
+			continue
+		}
+		var lines []string
+		for _, subTxt := range strings.Split(seg.Text, strings.TrimSpace(LN_SEP)) {
+			if subTxt = strings.TrimSpace(subTxt); len(subTxt) > 0 {
+				lines = append(lines, subTxt)
+			}
+		}
+		doc.Cues[seg.ID].Lines = lines
+	}
+}
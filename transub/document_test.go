@@ -0,0 +1,248 @@
+package transub
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDocument_SRT(t *testing.T) {
+	lines := strings.Split(`1
+00:00:01,000 --> 00:00:02,500
+1984
+
+2
+00:01:00,250 --> 00:01:03,000
+10 seconds left
+00:00 on the clock
+`, "\n")
+
+	doc, err := ParseDocument(lines, FormatSRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Cues) != 2 {
+		t.Fatalf("expected 2 cues, got %d", len(doc.Cues))
+	}
+	first, second := doc.Cues[0], doc.Cues[1]
+	if first.Start != time.Second || first.End != 2500*time.Millisecond {
+		t.Errorf("unexpected timing %v --> %v", first.Start, first.End)
+	}
+	if !reflect.DeepEqual(first.Lines, []string{"1984"}) {
+		t.Errorf("unexpected lines %q", first.Lines)
+	}
+	if second.Index != 2 || !reflect.DeepEqual(second.Lines, []string{"10 seconds left", "00:00 on the clock"}) {
+		t.Errorf("unexpected cue %+v", second)
+	}
+
+	segments := doc.translatableSegments(false)
+	if len(segments) != 2 || segments[1].Text != "10 seconds left"+LN_SEP+"00:00 on the clock" {
+		t.Errorf("unexpected segments %+v", segments)
+	}
+
+	if got := strings.Join(doc.Lines(), "\n"); got != strings.Join(lines, "\n") {
+		t.Errorf("round trip mismatch:\n%s", got)
+	}
+}
+
+func TestParseDocument_SSA(t *testing.T) {
+	lines, err := getFileStrLines("examples/subtitle.ssa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseDocument(lines, FormatSSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Cues) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(doc.Cues))
+	}
+	if doc.Cues[2].isTranslatable(false) {
+		t.Error("comments should not be translated")
+	}
+	if last := doc.Cues[4]; len(last.Lines) != 2 || last.Start != 110790*time.Millisecond {
+		t.Errorf("unexpected last cue %+v", last)
+	}
+	if !reflect.DeepEqual(doc.Lines(), lines) {
+		t.Errorf("round trip mismatch:\n%s", strings.Join(doc.Lines(), "\n"))
+	}
+}
+
+func TestParseDocument_VTT(t *testing.T) {
+	lines, err := getFileStrLines("examples/subtitle.vtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseDocument(lines, FormatVTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Cues) != 4 || doc.Cues[2].isTranslatable(false) {
+		t.Fatalf("unexpected cues %+v", doc.Cues)
+	}
+	if first := doc.Cues[0]; first.Meta[metaID] != "intro" || first.Meta[metaSettings] != "line:10% align:start" {
+		t.Errorf("unexpected first cue %+v", first)
+	}
+	if !reflect.DeepEqual(doc.Lines(), append(lines, "")) {
+		t.Errorf("round trip mismatch:\n%s", strings.Join(doc.Lines(), "\n"))
+	}
+
+	doc.protectMarkup()
+	segments := doc.translatableSegments(false)
+	want := []string{"Something", "Hello world!", "Please, translate all" + LN_SEP + "my {0}speach lines"}
+	for i, seg := range segments {
+		if seg.Text != want[i] {
+			t.Errorf("segment %d: got %q, want %q", i, seg.Text, want[i])
+		}
+	}
+	doc.Cues[3].Lines = []string{"Por favor, traduza todas", "minhas {0}falas"}
+	doc.restoreMarkup()
+	if got := doc.Cues[3].Lines; got[0] != "<i>Por favor, traduza todas</i>" || got[1] != "minhas <00:01:52.000>falas" {
+		t.Errorf("tags were not restored: %q", got)
+	}
+}
+
+func TestParseDocument_ASS(t *testing.T) {
+	lines := strings.Split(`[Script Info]
+ScriptType: v4.00+
+PlayResX: 1920
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, Bold, Italic, Alignment
+Style: Default,Arial,48,0,0,2
+Style: Sign,Arial,40,-1,0,8
+
+[Events]
+Format: Layer, Start, End, Style, Actor, MarginL, MarginR, MarginV, Effect, Text
+Comment: 0,0:00:00.00,0:00:01.00,Default,,0,0,0,,karaoke template
+Dialogue: 0,0:00:01.00,0:00:02.50,Sign,,0,0,0,,{\an8}{\pos(960,50)}Wait, look!
+Dialogue: 0,0:00:03.00,0:00:04.00,Default,Bob,0,0,0,,I said {\i1}no{\i0}.\NNever.`, "\n")
+
+	doc, err := ParseDocument(lines, FormatASS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Meta[ssaInfoPrefix+"PlayResX"] != "1920" || doc.Styles["Sign"]["Alignment"] != "8" {
+		t.Errorf("unexpected header meta %v %v", doc.Meta, doc.Styles)
+	}
+	if len(doc.Cues) != 3 || doc.Cues[0].isTranslatable(false) || doc.Cues[2].Meta["Actor"] != "Bob" {
+		t.Fatalf("unexpected cues %+v", doc.Cues)
+	}
+
+	doc.protectMarkup()
+	segments := doc.translatableSegments(false)
+	if segments[0].Text != "Wait, look!" || segments[1].Text != "I said {0}no{1}."+LN_SEP+"Never." {
+		t.Errorf("unexpected segments %+v", segments)
+	}
+	doc.Cues[1].Lines = []string{"Espera, olha!"}
+	doc.Cues[2].Lines = []string{"Eu disse {0}não{1}.", "Nunca."}
+	doc.restoreMarkup()
+
+	got := doc.Lines()
+	if got[len(got)-2] != `Dialogue: 0,0:00:01.00,0:00:02.50,Sign,,0,0,0,,{\an8}{\pos(960,50)}Espera, olha!` ||
+		got[len(got)-1] != `Dialogue: 0,0:00:03.00,0:00:04.00,Default,Bob,0,0,0,,Eu disse {\i1}não{\i0}.\NNunca.` {
+		t.Errorf("unexpected output:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestParseDocument_MicroDVD(t *testing.T) {
+	lines := []string{
+		"{1}{1}25",
+		"{25}{75}{y:i}Hello there!|General Kenobi.",
+		"{100}{}Bye",
+	}
+	doc, err := ParseDocument(lines, FormatMicroDVD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Format != FormatMicroDVD || len(doc.Cues) != 2 {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+	if first := doc.Cues[0]; first.Start != time.Second || first.End != 3*time.Second || len(first.Lines) != 2 {
+		t.Errorf("unexpected first cue %+v", first)
+	}
+
+	doc.protectMarkup()
+	if segments := doc.translatableSegments(false); segments[0].Text != "Hello there!"+LN_SEP+"General Kenobi." {
+		t.Errorf("unexpected segments %+v", segments)
+	}
+	doc.restoreMarkup()
+	if !reflect.DeepEqual(doc.Lines(), lines) {
+		t.Errorf("round trip mismatch:\n%s", strings.Join(doc.Lines(), "\n"))
+	}
+
+	doc.SetFrameRate(50)
+	if doc.Cues[0].Start != 500*time.Millisecond {
+		t.Errorf("frame rate was not applied, got %v", doc.Cues[0].Start)
+	}
+}
+
+func TestParseDocument_SubViewer(t *testing.T) {
+	lines := []string{
+		"[INFORMATION]",
+		"[TITLE]Example",
+		"[END INFORMATION]",
+		"[SUBTITLE]",
+		"[COLF]&HFFFFFF,[STYLE]bd,[SIZE]18,[FONT]Arial",
+		"00:00:41.00,00:00:44.40",
+		"The Age of Gods was closing.[br]Eternity had come to an end.",
+		"",
+	}
+	doc, err := ParseDocument(lines, FormatMicroDVD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Format != FormatSubViewer || len(doc.Cues) != 1 || len(doc.Cues[0].Lines) != 2 {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+	if doc.Cues[0].End != 44400*time.Millisecond {
+		t.Errorf("unexpected end %v", doc.Cues[0].End)
+	}
+	if !reflect.DeepEqual(doc.Lines(), lines) {
+		t.Errorf("round trip mismatch:\n%s", strings.Join(doc.Lines(), "\n"))
+	}
+}
+
+func TestParseDocument_TTML(t *testing.T) {
+	lines, err := getFileStrLines("examples/subtitle.ttml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ParseDocument(lines, FormatTTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Cues) != 3 || doc.Styles["italic"]["tts:fontStyle"] != "italic" {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+	second, third := doc.Cues[1], doc.Cues[2]
+	if doc.Cues[0].Start != 12126*time.Millisecond || second.End != 110792*time.Millisecond {
+		t.Errorf("unexpected timings %v %v", doc.Cues[0].Start, second.End)
+	}
+	if third.Start != 110800*time.Millisecond || len(third.Lines) != 2 {
+		t.Errorf("unexpected cue %+v", third)
+	}
+	if !reflect.DeepEqual(doc.Lines(), lines) {
+		t.Errorf("round trip mismatch:\n%s", strings.Join(doc.Lines(), "\n"))
+	}
+
+	doc.protectMarkup()
+	if segments := doc.translatableSegments(false); segments[1].Text != "Hello {0}world{1} {2} all!" {
+		t.Errorf("unexpected segments %+v", segments)
+	}
+	second.Lines = []string{"Olá {0}mundo{1} {2} todos!"}
+	third.Lines = []string{"Por favor, traduza", "todas as falas"}
+	third.Start += time.Second
+	doc.restoreMarkup()
+
+	got := strings.Join(doc.Lines(), "\n")
+	for _, want := range []string{
+		`<p begin="98.083s" dur="2.709s" style="italic">Olá <span tts:fontWeight="bold">mundo</span> &amp; todos!</p>`,
+		`<p begin="00:01:41:20" end="00:01:44:03">Por favor, traduza<br/>todas as falas</p>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output is missing %s:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package transub
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding names a subtitle file character encoding
+type Encoding string
+
+const (
+	EncodingUTF8        Encoding = "utf-8"
+	EncodingUTF16LE     Encoding = "utf-16le"
+	EncodingUTF16BE     Encoding = "utf-16be"
+	EncodingWindows1252 Encoding = "windows-1252"
+	EncodingISO88592    Encoding = "iso-8859-2"
+	// EncodingSource writes the output with the same encoding as the input
+	EncodingSource Encoding = "source"
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// ParseEncoding accepts the usual names and aliases for the supported
+// encodings, e.g. "utf8", "cp1252", "latin2"
+func ParseEncoding(name string) (Encoding, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "utf-8", "utf8":
+		return EncodingUTF8, true
+	case "utf-16", "utf16", "utf-16le", "utf16le":
+		return EncodingUTF16LE, true
+	case "utf-16be", "utf16be":
+		return EncodingUTF16BE, true
+	case "windows-1252", "cp1252", "latin1", "iso-8859-1":
+		return EncodingWindows1252, true
+	case "iso-8859-2", "latin2":
+		return EncodingISO88592, true
+	case "source":
+		return EncodingSource, true
+	}
+	return "", false
+}
+
+// textEncoding is how a text file was (or will be) stored on disk
+type textEncoding struct {
+	encoding  Encoding
+	bom       bool
+	lineBreak string
+}
+
+func (enc textEncoding) isUnicode() bool {
+	return enc.encoding == EncodingUTF8 || enc.encoding == EncodingUTF16LE || enc.encoding == EncodingUTF16BE
+}
+
+// detectEncoding looks for a BOM first. Without one, UTF-16 is recognised by
+// its zero bytes, valid UTF-8 is taken as is and anything else is scored as
+// Windows-1252 or ISO-8859-2
+func detectEncoding(data []byte) textEncoding {
+	enc := textEncoding{encoding: EncodingUTF8, lineBreak: LN_BREAK}
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		enc.bom = true
+	case bytes.HasPrefix(data, bomUTF16LE):
+		enc.encoding, enc.bom = EncodingUTF16LE, true
+	case bytes.HasPrefix(data, bomUTF16BE):
+		enc.encoding, enc.bom = EncodingUTF16BE, true
+	default:
+		enc.encoding = guessEncoding(data)
+	}
+	return enc
+}
+
+func guessEncoding(data []byte) Encoding {
+	if len(data) >= 2 {
+		var evenZeros, oddZeros int
+		for i, b := range data {
+			if b != 0 {
+				continue
+			}
+			if i%2 == 0 {
+				evenZeros++
+			} else {
+				oddZeros++
+			}
+		}
+		half := len(data) / 2
+		if oddZeros > half/2 && evenZeros < oddZeros/10 {
+			return EncodingUTF16LE
+		}
+		if evenZeros > half/2 && oddZeros < evenZeros/10 {
+			return EncodingUTF16BE
+		}
+	}
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	if singleByteScore(data, iso88592High) > singleByteScore(data, windows1252High) {
+		return EncodingISO88592
+	}
+	return EncodingWindows1252
+}
+
+// singleByteScore rewards non-ASCII bytes that decode to letters next to
+// other letters and penalises symbols inside words and C1 control codes
+func singleByteScore(data []byte, table *[128]rune) int {
+	decode := func(i int) rune {
+		if i < 0 || i >= len(data) {
+			return ' '
+		}
+		if data[i] < 0x80 {
+			return rune(data[i])
+		}
+		return table[data[i]-0x80]
+	}
+
+	score := 0
+	for i, b := range data {
+		if b < 0x80 {
+			continue
+		}
+		r := decode(i)
+		prev, next := decode(i-1), decode(i+1)
+		switch {
+		case r >= 0x80 && r <= 0x9f:
+			score -= 2
+		case unicode.IsLetter(r):
+			if unicode.IsLetter(prev) || unicode.IsLetter(next) {
+				score++
+			}
+		case unicode.IsLetter(prev) && unicode.IsLetter(next):
+			score--
+		}
+	}
+	return score
+}
+
+// decodeText converts data to UTF-8 and drops the BOM
+func decodeText(data []byte) (string, textEncoding) {
+	enc := detectEncoding(data)
+	var text string
+	switch enc.encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		if enc.bom {
+			data = data[2:]
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if enc.encoding == EncodingUTF16LE {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		text = string(utf16.Decode(units))
+	case EncodingWindows1252:
+		text = decodeSingleByte(data, windows1252High)
+	case EncodingISO88592:
+		text = decodeSingleByte(data, iso88592High)
+	default:
+		text = string(bytes.TrimPrefix(data, bomUTF8))
+	}
+
+	if crlf := strings.Count(text, "\r\n"); crlf > 0 && crlf >= strings.Count(text, "\n")-crlf {
+		enc.lineBreak = "\r\n"
+	}
+	return text, enc
+}
+
+func decodeSingleByte(data []byte, table *[128]rune) string {
+	var sb strings.Builder
+	sb.Grow(len(data))
+	for _, b := range data {
+		if b < 0x80 {
+			sb.WriteByte(b)
+			continue
+		}
+		sb.WriteRune(table[b-0x80])
+	}
+	return sb.String()
+}
+
+// encodeText converts UTF-8 text to enc. It fails if a character can not be
+// represented by a single byte encoding
+func encodeText(text string, enc textEncoding) ([]byte, error) {
+	var buf bytes.Buffer
+	switch enc.encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		if enc.bom {
+			text = "\ufeff" + text
+		}
+		for _, unit := range utf16.Encode([]rune(text)) {
+			if enc.encoding == EncodingUTF16LE {
+				buf.Write([]byte{byte(unit), byte(unit >> 8)})
+			} else {
+				buf.Write([]byte{byte(unit >> 8), byte(unit)})
+			}
+		}
+	case EncodingWindows1252, EncodingISO88592:
+		table := windows1252High
+		if enc.encoding == EncodingISO88592 {
+			table = iso88592High
+		}
+		for _, r := range text {
+			b, ok := encodeSingleByte(r, table)
+			if !ok {
+				return nil, fmt.Errorf("[transub] character %q can not be written as %s", r, enc.encoding)
+			}
+			buf.WriteByte(b)
+		}
+	default:
+		if enc.bom {
+			buf.Write(bomUTF8)
+		}
+		buf.WriteString(text)
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeSingleByte(r rune, table *[128]rune) (byte, bool) {
+	if r < 0x80 {
+		return byte(r), true
+	}
+	for i, tr := range table {
+		if tr == r {
+			return byte(0x80 + i), true
+		}
+	}
+	return 0, false
+}
+
+// readTextFile decodes a file to UTF-8 lines. Lines are trimmed like the
+// rest of the parsers expect
+func readTextFile(filename string) ([]string, textEncoding, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, textEncoding{}, err
+	}
+	lines, enc := decodeLines(data)
+	return lines, enc, nil
+}
+
+// decodeLines splits the decoded text in trimmed lines
+func decodeLines(data []byte) ([]string, textEncoding) {
+	text, enc := decodeText(data)
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(text) == 0 {
+		return nil, enc
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(strings.Trim(line, "\ufeff"))
+	}
+	return lines, enc
+}
+
+// encodeLines joins lines with the encoding line break, ending every line
+func encodeLines(lines []string, enc textEncoding) ([]byte, error) {
+	lineBreak := enc.lineBreak
+	if len(lineBreak) == 0 {
+		lineBreak = LN_BREAK
+	}
+	var sb strings.Builder
+	for _, line := range lines {
+		line = strings.ReplaceAll(line, "\r\n", "\n")
+		sb.WriteString(strings.ReplaceAll(line, "\n", lineBreak) + lineBreak)
+	}
+	return encodeText(sb.String(), enc)
+}
+
+// windows1252High maps bytes 0x80-0xff. The five undefined bytes map to the
+// matching C1 control code, like browsers do
+var windows1252High = &[128]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+	0x00a0, 0x00a1, 0x00a2, 0x00a3, 0x00a4, 0x00a5, 0x00a6, 0x00a7,
+	0x00a8, 0x00a9, 0x00aa, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x00af,
+	0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x00b4, 0x00b5, 0x00b6, 0x00b7,
+	0x00b8, 0x00b9, 0x00ba, 0x00bb, 0x00bc, 0x00bd, 0x00be, 0x00bf,
+	0x00c0, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x00c7,
+	0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf,
+	0x00d0, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x00d7,
+	0x00d8, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x00dd, 0x00de, 0x00df,
+	0x00e0, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x00e7,
+	0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef,
+	0x00f0, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x00f7,
+	0x00f8, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x00fd, 0x00fe, 0x00ff,
+}
+
+// iso88592High maps bytes 0x80-0xff (0x80-0x9f are C1 control codes)
+var iso88592High = &[128]rune{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008a, 0x008b, 0x008c, 0x008d, 0x008e, 0x008f,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009a, 0x009b, 0x009c, 0x009d, 0x009e, 0x009f,
+	0x00a0, 0x0104, 0x02d8, 0x0141, 0x00a4, 0x013d, 0x015a, 0x00a7,
+	0x00a8, 0x0160, 0x015e, 0x0164, 0x0179, 0x00ad, 0x017d, 0x017b,
+	0x00b0, 0x0105, 0x02db, 0x0142, 0x00b4, 0x013e, 0x015b, 0x02c7,
+	0x00b8, 0x0161, 0x015f, 0x0165, 0x017a, 0x02dd, 0x017e, 0x017c,
+	0x0154, 0x00c1, 0x00c2, 0x0102, 0x00c4, 0x0139, 0x0106, 0x00c7,
+	0x010c, 0x00c9, 0x0118, 0x00cb, 0x011a, 0x00cd, 0x00ce, 0x010e,
+	0x0110, 0x0143, 0x0147, 0x00d3, 0x00d4, 0x0150, 0x00d6, 0x00d7,
+	0x0158, 0x016e, 0x00da, 0x0170, 0x00dc, 0x00dd, 0x0162, 0x00df,
+	0x0155, 0x00e1, 0x00e2, 0x0103, 0x00e4, 0x013a, 0x0107, 0x00e7,
+	0x010d, 0x00e9, 0x0119, 0x00eb, 0x011b, 0x00ed, 0x00ee, 0x010f,
+	0x0111, 0x0144, 0x0148, 0x00f3, 0x00f4, 0x0151, 0x00f6, 0x00f7,
+	0x0159, 0x016f, 0x00fa, 0x0171, 0x00fc, 0x00fd, 0x0163, 0x02d9,
+}
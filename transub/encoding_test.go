@@ -0,0 +1,95 @@
+package transub
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestDecodeText(t *testing.T) {
+	utf16LE := func(s string, bom bool) []byte {
+		var buf bytes.Buffer
+		if bom {
+			buf.Write(bomUTF16LE)
+		}
+		for _, u := range utf16.Encode([]rune(s)) {
+			buf.Write([]byte{byte(u), byte(u >> 8)})
+		}
+		return buf.Bytes()
+	}
+	utf16BE := func(s string) []byte {
+		var buf bytes.Buffer
+		for _, u := range utf16.Encode([]rune(s)) {
+			buf.Write([]byte{byte(u >> 8), byte(u)})
+		}
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		text string
+		enc  textEncoding
+	}{
+		{"utf-8", []byte("Olá mundo\n"), "Olá mundo\n", textEncoding{EncodingUTF8, false, "\n"}},
+		{"utf-8 bom", append(append([]byte{}, bomUTF8...), "Olá\r\n"...), "Olá\r\n", textEncoding{EncodingUTF8, true, "\r\n"}},
+		{"utf-16le bom", utf16LE("1\r\nOlá\r\n", true), "1\r\nOlá\r\n", textEncoding{EncodingUTF16LE, true, "\r\n"}},
+		{"utf-16le", utf16LE("1\nOlá mundo\n", false), "1\nOlá mundo\n", textEncoding{EncodingUTF16LE, false, "\n"}},
+		{"utf-16be", utf16BE("1\nOlá mundo\n"), "1\nOlá mundo\n", textEncoding{EncodingUTF16BE, false, "\n"}},
+		{"windows-1252", []byte("Ent\xe3o, voc\xea n\xe3o vai \x93sair\x94?\r\n"), "Então, você não vai “sair”?\r\n", textEncoding{EncodingWindows1252, false, "\r\n"}},
+		{"iso-8859-2", []byte("Dzi\xeakuj\xea, \xbfe przysz\xb3a\xb6. D\xeckuji, \xb9\xbbastn\xfd\n"), "Dziękuję, że przyszłaś. Děkuji, šťastný\n", textEncoding{EncodingISO88592, false, "\n"}},
+	}
+	for _, tt := range tests {
+		text, enc := decodeText(tt.data)
+		if text != tt.text {
+			t.Errorf("%s: got %q, want %q", tt.name, text, tt.text)
+		}
+		if enc != tt.enc {
+			t.Errorf("%s: got encoding %+v, want %+v", tt.name, enc, tt.enc)
+		}
+		encoded, err := encodeText(text, enc)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !bytes.Equal(encoded, tt.data) {
+			t.Errorf("%s: round trip got % x, want % x", tt.name, encoded, tt.data)
+		}
+	}
+
+	if _, err := encodeText("ação", textEncoding{encoding: EncodingISO88592}); err == nil {
+		t.Error("expected an error for 'ã' in iso-8859-2")
+	}
+}
+
+func TestTransub_TranslateLegacyEncoding(t *testing.T) {
+	src := "1\r\n00:00:01,000 --> 00:00:02,000\r\nVoc\xea est\xe1 a\xed?\r\n"
+	filename := filepath.Join(t.TempDir(), "legacy.srt")
+	if err := os.WriteFile(filename, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Validator.isTextFile(filename); !ok || err != nil {
+		t.Fatalf("windows-1252 file rejected: %v", err)
+	}
+
+	tr := New(filename, "en", WithTranslator(fakeTranslator{lang: "pt"}), WithOutputEncoding(EncodingSource))
+	if _, err := tr.TranslasteSRT(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(tr.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, []byte("1\r\n00:00:01,000 --> 00:00:02,000\r\nVOC\xca EST\xc1 A\xcd?\r\n")) {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	marked, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(marked, []byte(src)) {
+		t.Errorf("source file was re-encoded: %q", marked)
+	}
+}
@@ -20,9 +20,10 @@ func main() {
 		//WithOutputDir("another/dir/to/output/file"),
 	)
 
-	err := ts.TranslasteSRT()
+	res, err := ts.TranslasteSRT()
 	if err != nil {
 		log.Fatal(err)
 	}
+	log.Println(res)
 
 }
@@ -0,0 +1,245 @@
+package transub
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Glossary holds the terms that must not be left to the translator:
+// names and places kept as they are and forced translations per language
+// pair. A glossary file looks like:
+//
+//	# do not translate
+//	Hope
+//	King's Landing
+//	# forced translations for any language pair
+//	Dragonstone = Pedra do Dragão
+//	# forced translations for english to portuguese only
+//	[en-pt]
+//	Night's Watch = Patrulha da Noite
+type Glossary struct {
+	DoNotTranslate []string
+	// Terms maps a "src-dest" language pair (or "*" for any pair) to the
+	// source terms and their forced translations
+	Terms map[string]map[string]string
+}
+
+// glossaryPlaceholderRe matches "{g0}" and the ways engines mangle it
+var glossaryPlaceholderRe = regexp.MustCompile(`(?i)\{\s*g\s*(\d+)\s*\}`)
+
+// LoadGlossary reads and merges glossary files. Later files win, so a
+// per-project glossary goes after the global ones
+func LoadGlossary(filenames ...string) (*Glossary, error) {
+	glossary := &Glossary{}
+	for _, filename := range filenames {
+		lines, err := getFileStrLines(filename)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseGlossary(lines)
+		if err != nil {
+			return nil, fmt.Errorf("[glossary] %s: %w", filename, err)
+		}
+		glossary = glossary.Merge(parsed)
+	}
+	return glossary, nil
+}
+
+func WithGlossary(glossary *Glossary) func(*Options) {
+	return func(opt *Options) {
+		opt.Glossary = glossary
+	}
+}
+
+// WithProjectGlossary looks for a glossary file with this name in the
+// subtitle directory and its parents. The nearest one is merged over the
+// WithGlossary one
+func WithProjectGlossary(filename string) func(*Options) {
+	return func(opt *Options) {
+		opt.ProjectGlossary = filename
+	}
+}
+
+func parseGlossary(lines []string) (*Glossary, error) {
+	glossary := &Glossary{}
+	pair := "*"
+	for i, line := range lines {
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			pair = glossaryPair(strings.Trim(line, "[]"))
+			if !strings.Contains(pair, "-") && pair != "*" {
+				return nil, fmt.Errorf("line %d: invalid language pair %s, eg: [en-pt]", i+1, line)
+			}
+			continue
+		}
+		term, target, isMapping := strings.Cut(line, "=")
+		term, target = strings.TrimSpace(term), strings.TrimSpace(target)
+		if !isMapping {
+			glossary.DoNotTranslate = append(glossary.DoNotTranslate, term)
+			continue
+		}
+		if len(term) == 0 || len(target) == 0 {
+			return nil, fmt.Errorf("line %d: invalid term mapping %s", i+1, line)
+		}
+		glossary.addTerm(pair, term, target)
+	}
+	return glossary, nil
+}
+
+func glossaryPair(pair string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(pair), " ", ""))
+}
+
+func (g *Glossary) addTerm(pair, term, target string) {
+	if g.Terms == nil {
+		g.Terms = map[string]map[string]string{}
+	}
+	if g.Terms[pair] == nil {
+		g.Terms[pair] = map[string]string{}
+	}
+	g.Terms[pair][term] = target
+}
+
+// Merge returns a new glossary with the terms of both, other winning on
+// conflicting mappings
+func (g *Glossary) Merge(other *Glossary) *Glossary {
+	merged := &Glossary{}
+	for _, glossary := range []*Glossary{g, other} {
+		if glossary == nil {
+			continue
+		}
+		merged.DoNotTranslate = append(merged.DoNotTranslate, glossary.DoNotTranslate...)
+		for pair, terms := range glossary.Terms {
+			for term, target := range terms {
+				merged.addTerm(glossaryPair(pair), term, target)
+			}
+		}
+	}
+	return merged
+}
+
+// termsFor returns every protected term for a language pair and what it
+// becomes after translation
+func (g *Glossary) termsFor(src, dest string) map[string]string {
+	terms := map[string]string{}
+	if g == nil {
+		return terms
+	}
+	for _, term := range g.DoNotTranslate {
+		terms[term] = term
+	}
+	for _, pair := range []string{"*", glossaryPair(src + "-" + dest)} {
+		for term, target := range g.Terms[pair] {
+			terms[term] = target
+		}
+	}
+	return terms
+}
+
+// protectSegments swaps the glossary terms for "{gN}" placeholders. It
+// returns the protected copies and, per segment, the text each placeholder
+// must be restored to
+func (g *Glossary) protectSegments(segments []Segment, src, dest string) ([]Segment, [][]string) {
+	terms := g.termsFor(src, dest)
+	protected := make([]Segment, len(segments))
+	targets := make([][]string, len(segments))
+	if len(terms) == 0 {
+		copy(protected, segments)
+		return protected, targets
+	}
+
+	// longest terms first, so "King's Landing" wins over "King"
+	sorted := make([]string, 0, len(terms))
+	for term := range terms {
+		sorted = append(sorted, regexp.QuoteMeta(term))
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	termRe := regexp.MustCompile(strings.Join(sorted, "|"))
+
+	for i, seg := range segments {
+		var sb strings.Builder
+		last := 0
+		for _, loc := range termRe.FindAllStringIndex(seg.Text, -1) {
+			if !isWordBoundary(seg.Text, loc[0], loc[1]) {
+				continue
+			}
+			sb.WriteString(seg.Text[last:loc[0]])
+			sb.WriteString(fmt.Sprintf("{g%d}", len(targets[i])))
+			targets[i] = append(targets[i], terms[seg.Text[loc[0]:loc[1]]])
+			last = loc[1]
+		}
+		sb.WriteString(seg.Text[last:])
+		protected[i] = Segment{ID: seg.ID, Text: sb.String()}
+	}
+	return protected, targets
+}
+
+// isWordBoundary checks text[start:end] is not part of a bigger word. The
+// regexp \b only knows ascii letters
+func isWordBoundary(text string, start, end int) bool {
+	isWordRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+	}
+	before, _ := utf8.DecodeLastRuneInString(text[:start])
+	after, _ := utf8.DecodeRuneInString(text[end:])
+	return (start == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after))
+}
+
+// lostTerm is a glossary term the translator dropped from a segment
+type lostTerm struct {
+	ID   int
+	Term string
+}
+
+// restoreGlossary puts the terms back on the translated segments and
+// returns the ones the translator lost
+func restoreGlossary(segments []Segment, targets [][]string) ([]Segment, []lostTerm) {
+	var lost []lostTerm
+	restored := make([]Segment, len(segments))
+	for i, seg := range segments {
+		found := make([]bool, len(targets[i]))
+		text := glossaryPlaceholderRe.ReplaceAllStringFunc(seg.Text, func(placeholder string) string {
+			idx, _ := strconv.Atoi(glossaryPlaceholderRe.FindStringSubmatch(placeholder)[1])
+			if idx >= len(targets[i]) {
+				return placeholder
+			}
+			found[idx] = true
+			return targets[i][idx]
+		})
+		for idx, ok := range found {
+			if !ok {
+				lost = append(lost, lostTerm{ID: seg.ID, Term: targets[i][idx]})
+			}
+		}
+		restored[i] = Segment{ID: seg.ID, Text: text}
+	}
+	return restored, lost
+}
+
+// findProjectGlossary returns the nearest glossary named filename, from the
+// subtitle directory up to the filesystem root
+func findProjectGlossary(subtitlePath, filename string) string {
+	dir, err := filepath.Abs(filepath.Dir(subtitlePath))
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(dir, filename)
+		if Validator.isReachableFile(candidate) {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,74 @@
+package transub
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGlossary_protectSegments(t *testing.T) {
+	glossary, err := parseGlossary(strings.Split(`# names
+Hope
+King's Landing
+Dragonstone = Pedra do Dragão
+[en-pt]
+Night's Watch = Patrulha da Noite
+[en-es]
+Night's Watch = Guardia de la Noche`, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segments := []Segment{
+		{ID: 0, Text: "Hope left King's Landing for Dragonstone."},
+		{ID: 2, Text: "I hope the Night's Watch comes. Hopeless!"},
+	}
+	protected, terms := glossary.protectSegments(segments, "en", "pt")
+	want := []Segment{
+		{ID: 0, Text: "{g0} left {g1} for {g2}."},
+		{ID: 2, Text: "I hope the {g0} comes. Hopeless!"},
+	}
+	if !reflect.DeepEqual(protected, want) {
+		t.Errorf("got %+v, want %+v", protected, want)
+	}
+
+	translated := []Segment{
+		{ID: 0, Text: "{g0} deixou { G1 } por {g2}."},
+		{ID: 2, Text: "Espero que a patrulha venha. Sem esperança!"},
+	}
+	restored, lost := restoreGlossary(translated, terms)
+	if restored[0].Text != "Hope deixou King's Landing por Pedra do Dragão." {
+		t.Errorf("unexpected restore %q", restored[0].Text)
+	}
+	if restored[1].Text != translated[1].Text {
+		t.Errorf("segment without placeholders changed: %q", restored[1].Text)
+	}
+	if len(lost) != 1 || lost[0].ID != 2 {
+		t.Errorf("expected the segment 2 term lost, got %+v", lost)
+	}
+}
+
+func TestTransub_WithProjectGlossary(t *testing.T) {
+	filename := copyExample(t, "subtitle.srt")
+	project := filepath.Join(filepath.Dir(filename), "transub.glossary")
+	if err := os.WriteFile(project, []byte("world\n[en-pt]\nthink = pensar\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	global := &Glossary{DoNotTranslate: []string{"Hello"}}
+
+	tr := New(filename, "pt", WithTranslator(fakeTranslator{lang: "en"}), WithGlossary(global), WithProjectGlossary("transub.glossary"))
+	if _, err := tr.TranslasteSRT(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(tr.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"- Hello world!", "- I'LL pensar ABOUT IT"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package transub
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	gtrans "github.com/lcapuano-app/go-googletrans"
+)
+
+type googleTranslator struct {
+	cfg     GTransCfg
+	retries int
+}
+
+func NewGoogleTranslator(cfg GTransCfg, retries int) Translator {
+	return &googleTranslator{cfg: cfg, retries: retries}
+}
+
+func (g *googleTranslator) Translate(text, src, dest string) (string, error) {
+	return g.TranslateContext(context.Background(), text, src, dest)
+}
+
+// TranslateContext stops retrying once ctx is done. go-googletrans requests
+// can not be cancelled, the one in flight is left to finish on its own
+func (g *googleTranslator) TranslateContext(ctx context.Context, text, src, dest string) (string, error) {
+	gTranslator := *gtrans.New(g.cfg)
+	return g.translate(ctx, text, src, dest, g.retries, gTranslator)
+}
+
+func (g *googleTranslator) translate(ctx context.Context, text, src, dest string, retries int, gTranslator gtrans.Translator) (string, error) {
+	result, err := withContext(ctx, func() (*gtrans.Translated, error) {
+		return gTranslator.Translate(text, src, dest)
+	})
+	if err == nil {
+		return result.Text, nil
+	}
+
+	if retries <= 0 || ctx.Err() != nil {
+		return text, err
+	}
+
+	msg := fmt.Sprintf("will attempt with a diferent service url and user agent. attempts left [%d]", retries)
+	log.Println(err, msg)
+	retries--
+
+	gTranslator = *gtrans.New(gtrans.Config{
+		ServiceUrls: gtrans.GetDefaultServiceUrls(),
+		UserAgent:   []string{},
+		Proxy:       g.cfg.Proxy,
+	})
+	return g.translate(ctx, text, src, dest, retries, gTranslator)
+}
+
+func (g *googleTranslator) DetectLanguage(text string) (string, float64, error) {
+	return g.DetectLanguageContext(context.Background(), text)
+}
+
+func (g *googleTranslator) DetectLanguageContext(ctx context.Context, text string) (string, float64, error) {
+	translator := gtrans.New(g.cfg)
+	res, err := withContext(ctx, func() (gtrans.LDResponse, error) {
+		return translator.DetectLanguage(text, "auto")
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return res.Src, res.Confidence, nil
+}
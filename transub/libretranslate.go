@@ -0,0 +1,116 @@
+package transub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type LibreTranslateCfg struct {
+	URL    string
+	APIKey string
+}
+
+type libreTranslator struct {
+	cfg    LibreTranslateCfg
+	client *http.Client
+}
+
+type libreTranslateReq struct {
+	Q      string `json:"q"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	Format string `json:"format,omitempty"`
+	APIKey string `json:"api_key,omitempty"`
+}
+
+type libreTranslateRes struct {
+	TranslatedText string `json:"translatedText"`
+	Error          string `json:"error"`
+}
+
+type libreDetectRes struct {
+	Language   string  `json:"language"`
+	Confidence float64 `json:"confidence"`
+}
+
+func NewLibreTranslator(cfg LibreTranslateCfg) Translator {
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	if len(cfg.URL) == 0 {
+		cfg.URL = libreDefaultURL
+	}
+	return &libreTranslator{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func WithLibreTranslateCfg(cfg LibreTranslateCfg) func(*Options) {
+	return func(opt *Options) {
+		opt.LibreTranslate = cfg
+	}
+}
+
+func (l *libreTranslator) Translate(text, src, dest string) (string, error) {
+	return l.TranslateContext(context.Background(), text, src, dest)
+}
+
+func (l *libreTranslator) TranslateContext(ctx context.Context, text, src, dest string) (string, error) {
+	reqBody := libreTranslateReq{
+		Q:      text,
+		Source: src,
+		Target: dest,
+		Format: "text",
+		APIKey: l.cfg.APIKey,
+	}
+	var res libreTranslateRes
+	if err := l.post(ctx, "/translate", reqBody, &res); err != nil {
+		return text, err
+	}
+	return res.TranslatedText, nil
+}
+
+func (l *libreTranslator) DetectLanguage(text string) (string, float64, error) {
+	return l.DetectLanguageContext(context.Background(), text)
+}
+
+func (l *libreTranslator) DetectLanguageContext(ctx context.Context, text string) (string, float64, error) {
+	reqBody := libreTranslateReq{Q: text, APIKey: l.cfg.APIKey}
+	var res []libreDetectRes
+	if err := l.post(ctx, "/detect", reqBody, &res); err != nil {
+		return "", 0, err
+	}
+	if len(res) == 0 {
+		return "", 0, fmt.Errorf("[libretranslate] could not detect language")
+	}
+	// libretranslate confidences goes from 0 to 100
+	return res[0].Language, res[0].Confidence / 100, nil
+}
+
+func (l *libreTranslator) post(ctx context.Context, endpoint string, reqBody, resBody any) error {
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.cfg.URL+endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var errRes libreTranslateRes
+		json.NewDecoder(res.Body).Decode(&errRes)
+		return fmt.Errorf("[libretranslate] %s %s: %s", endpoint, res.Status, errRes.Error)
+	}
+	return json.NewDecoder(res.Body).Decode(resBody)
+}
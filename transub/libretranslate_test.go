@@ -0,0 +1,44 @@
+package transub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLibreTranslator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req libreTranslateReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.APIKey != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(libreTranslateRes{Error: "invalid api key"})
+			return
+		}
+		switch r.URL.Path {
+		case "/translate":
+			json.NewEncoder(w).Encode(libreTranslateRes{TranslatedText: req.Target + ":" + req.Q})
+		case "/detect":
+			json.NewEncoder(w).Encode([]libreDetectRes{{Language: "en", Confidence: 90}})
+		}
+	}))
+	defer srv.Close()
+
+	tr := NewLibreTranslator(LibreTranslateCfg{URL: srv.URL + "/", APIKey: "secret"})
+	text, err := tr.Translate("hello", "en", "pt")
+	if err != nil || text != "pt:hello" {
+		t.Fatalf("got %q, %v", text, err)
+	}
+	lang, confidence, err := tr.DetectLanguage("hello")
+	if err != nil || lang != "en" || confidence != 0.9 {
+		t.Fatalf("got %q %v, %v", lang, confidence, err)
+	}
+
+	tr = NewLibreTranslator(LibreTranslateCfg{URL: srv.URL})
+	if _, err = tr.Translate("hello", "en", "pt"); err == nil {
+		t.Fatal("expected an error without api key")
+	}
+}
@@ -0,0 +1,239 @@
+package transub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	llmDefaultPrompt = "You are a professional subtitle translator. Translate the dialogues " +
+		"keeping their meaning, tone, idioms and the consistency between lines."
+	llmFormatPrompt = "The user sends a json object with 'source_language', 'target_language', " +
+		"'cues' to translate and optional 'context_before' and 'context_after' cues. " +
+		"Context cues are only there to help you understand the scene, do not translate them. " +
+		"Keep any ' /// ' marker as it is, it separates lines of the same cue. " +
+		"Keep placeholders like {0} or {1} untouched, next to the words they mark. " +
+		"Answer ONLY with a json object like {\"translations\":[{\"id\":1,\"text\":\"...\"}]} " +
+		"containing exactly one entry for each cue id received."
+)
+
+type LLMCfg struct {
+	// URL is the base url of an OpenAI compatible api, eg: http://localhost:11434/v1 (ollama)
+	URL          string
+	APIKey       string
+	Model        string
+	Temperature  float64
+	SystemPrompt string
+	// ContextWindow is how many previous and next cues are sent along with each batch
+	ContextWindow int
+}
+
+type llmTranslator struct {
+	cfg    LLMCfg
+	client *http.Client
+}
+
+type llmMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type llmChatReq struct {
+	Model          string            `json:"model"`
+	Temperature    float64           `json:"temperature"`
+	Messages       []llmMessage      `json:"messages"`
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+}
+
+type llmChatRes struct {
+	Choices []struct {
+		Message llmMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type llmBatchReq struct {
+	SourceLanguage string    `json:"source_language"`
+	TargetLanguage string    `json:"target_language"`
+	ContextBefore  []Segment `json:"context_before,omitempty"`
+	Cues           []Segment `json:"cues"`
+	ContextAfter   []Segment `json:"context_after,omitempty"`
+}
+
+type llmBatchRes struct {
+	Translations []Segment `json:"translations"`
+}
+
+func NewLLMTranslator(cfg LLMCfg) Translator {
+	if len(cfg.URL) == 0 {
+		cfg.URL = llmDefaultURL
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	if len(cfg.APIKey) == 0 {
+		cfg.APIKey = os.Getenv(llmAPIKeyEnv)
+	}
+	if len(cfg.Model) == 0 {
+		cfg.Model = llmDefaultModel
+	}
+	if len(cfg.SystemPrompt) == 0 {
+		cfg.SystemPrompt = llmDefaultPrompt
+	}
+	if cfg.ContextWindow < 0 {
+		cfg.ContextWindow = 0
+	}
+	return &llmTranslator{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func WithLLMCfg(cfg LLMCfg) func(*Options) {
+	return func(opt *Options) {
+		opt.LLM = cfg
+	}
+}
+
+func (l *llmTranslator) CharLimit() int {
+	return llmCharLimit
+}
+
+func (l *llmTranslator) ContextWindow() int {
+	return l.cfg.ContextWindow
+}
+
+func (l *llmTranslator) Translate(text, src, dest string) (string, error) {
+	return l.TranslateContext(context.Background(), text, src, dest)
+}
+
+func (l *llmTranslator) TranslateContext(ctx context.Context, text, src, dest string) (string, error) {
+	prompt := fmt.Sprintf(
+		"Translate the following text from '%s' to '%s'. Answer only with the translation.\n\n%s",
+		src, dest, text,
+	)
+	content, err := l.chat(ctx, l.cfg.SystemPrompt, prompt, false)
+	if err != nil {
+		return text, err
+	}
+	return strings.TrimSpace(content), nil
+}
+
+func (l *llmTranslator) DetectLanguage(text string) (string, float64, error) {
+	return l.DetectLanguageContext(context.Background(), text)
+}
+
+func (l *llmTranslator) DetectLanguageContext(ctx context.Context, text string) (string, float64, error) {
+	prompt := "Answer only with the ISO 639-1 code of the language of this text:\n\n" + text
+	content, err := l.chat(ctx, "You are a language detector.", prompt, false)
+	if err != nil {
+		return "", 0, err
+	}
+	lang := strings.ToLower(strings.Trim(strings.TrimSpace(content), ".'\"`"))
+	return lang, 1, nil
+}
+
+func (l *llmTranslator) TranslateSegments(batch, before, after []Segment, src, dest string) ([]Segment, error) {
+	return l.TranslateSegmentsContext(context.Background(), batch, before, after, src, dest)
+}
+
+func (l *llmTranslator) TranslateSegmentsContext(ctx context.Context, batch, before, after []Segment, src, dest string) ([]Segment, error) {
+	reqBody := llmBatchReq{
+		SourceLanguage: src,
+		TargetLanguage: dest,
+		ContextBefore:  before,
+		Cues:           batch,
+		ContextAfter:   after,
+	}
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	content, err := l.chat(ctx, l.cfg.SystemPrompt+"\n\n"+llmFormatPrompt, string(payload), true)
+	if err != nil {
+		return nil, err
+	}
+
+	// some models wraps the json into markdown fences
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("[llm] response is not a json object: %s", content)
+	}
+	var res llmBatchRes
+	if err = json.Unmarshal([]byte(content[start:end+1]), &res); err != nil {
+		return nil, fmt.Errorf("[llm] invalid response: %w", err)
+	}
+
+	translateds := make(map[int]string, len(res.Translations))
+	for _, seg := range res.Translations {
+		translateds[seg.ID] = seg.Text
+	}
+	var segments []Segment
+	var missing []int
+	for _, seg := range batch {
+		text, ok := translateds[seg.ID]
+		if !ok || len(strings.TrimSpace(text)) == 0 {
+			missing = append(missing, seg.ID)
+			continue
+		}
+		segments = append(segments, Segment{ID: seg.ID, Text: text})
+	}
+	if len(missing) > 0 {
+		return segments, fmt.Errorf("[llm] cues %v missing from response", missing)
+	}
+	return segments, nil
+}
+
+func (l *llmTranslator) chat(ctx context.Context, system, user string, jsonOutput bool) (string, error) {
+	reqBody := llmChatReq{
+		Model:       l.cfg.Model,
+		Temperature: l.cfg.Temperature,
+		Messages: []llmMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: user},
+		},
+	}
+	if jsonOutput {
+		reqBody.ResponseFormat = map[string]string{"type": "json_object"}
+	}
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.cfg.URL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(l.cfg.APIKey) > 0 {
+		req.Header.Set("Authorization", "Bearer "+l.cfg.APIKey)
+	}
+
+	httpRes, err := l.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer httpRes.Body.Close()
+
+	var res llmChatRes
+	err = json.NewDecoder(httpRes.Body).Decode(&res)
+	if httpRes.StatusCode != http.StatusOK {
+		if err != nil || res.Error == nil || len(res.Error.Message) == 0 {
+			return "", fmt.Errorf("[llm] %s", httpRes.Status)
+		}
+		return "", fmt.Errorf("[llm] %s: %s", httpRes.Status, res.Error.Message)
+	}
+	if err != nil {
+		return "", fmt.Errorf("[llm] decode response: %w", err)
+	}
+	if len(res.Choices) == 0 {
+		return "", fmt.Errorf("[llm] empty chat response")
+	}
+	return res.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,61 @@
+package transub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLLMTranslator_TranslateSegments(t *testing.T) {
+	var got llmBatchReq
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req llmChatReq
+		json.NewDecoder(r.Body).Decode(&req)
+		json.Unmarshal([]byte(req.Messages[1].Content), &got)
+
+		// drops the last cue, which must not be filled in
+		var res llmBatchRes
+		for _, seg := range got.Cues[:len(got.Cues)-1] {
+			res.Translations = append(res.Translations, Segment{ID: seg.ID, Text: strings.ToUpper(seg.Text)})
+		}
+		content, _ := json.Marshal(res)
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": llmMessage{Role: "assistant", Content: "```json\n" + string(content) + "\n```"}}},
+		})
+	}))
+	defer srv.Close()
+
+	tr := NewLLMTranslator(LLMCfg{URL: srv.URL, ContextWindow: 1}).(*llmTranslator)
+	batch := []Segment{{ID: 4, Text: "hello"}, {ID: 8, Text: "world"}}
+	before := []Segment{{ID: 1, Text: "previous"}}
+	segments, err := tr.TranslateSegments(batch, before, nil, "en", "pt")
+	if err == nil {
+		t.Error("expected an error for the missing cue")
+	}
+	if len(got.ContextBefore) != 1 || got.ContextBefore[0].ID != 1 {
+		t.Errorf("context was not sent: %+v", got)
+	}
+	if len(segments) != 1 || segments[0].Text != "HELLO" {
+		t.Errorf("unexpected segments %+v", segments)
+	}
+}
+
+func TestLLMTranslator_BadResponse(t *testing.T) {
+	status, body := http.StatusOK, `{"choices":[{"message":{"content":"Ol`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	tr := NewLLMTranslator(LLMCfg{URL: srv.URL})
+
+	if _, err := tr.Translate("Hello", "en", "pt"); err == nil || !strings.Contains(err.Error(), "decode response") {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+	status, body = http.StatusBadGateway, "<html>Bad Gateway</html>"
+	if _, err := tr.Translate("Hello", "en", "pt"); err == nil || err.Error() != "[llm] 502 Bad Gateway" {
+		t.Errorf("expected the raw status, got %v", err)
+	}
+}
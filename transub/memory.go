@@ -0,0 +1,276 @@
+package transub
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryEntry is a translation stored on the translation memory
+type MemoryEntry struct {
+	Backend     string    `json:"backend"`
+	Src         string    `json:"src"`
+	Dest        string    `json:"dest"`
+	Text        string    `json:"text"`
+	Translation string    `json:"translation"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type memoryKey struct {
+	backend, src, dest, text string
+}
+
+func (e MemoryEntry) key() memoryKey {
+	return memoryKey{e.Backend, e.Src, e.Dest, normalizeMemoryText(e.Text)}
+}
+
+// Memory is a persistent translation memory, so lines repeated across
+// files ("Previously on...", theme songs) are translated only once. It is
+// stored as a json lines file where new entries are appended and the
+// last entry of a key wins. Memory is safe for concurrent use
+type Memory struct {
+	path    string
+	mu      sync.Mutex
+	entries map[memoryKey]MemoryEntry
+}
+
+// OpenMemory loads the translation memory at path, which is created on the
+// first write if it does not exist
+func OpenMemory(path string) (*Memory, error) {
+	m := &Memory{path: path, entries: map[memoryKey]MemoryEntry{}}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	loaded, err := readMemoryEntries(file)
+	if err != nil {
+		return nil, fmt.Errorf("[memory] %s: %w", path, err)
+	}
+	m.store(loaded)
+	return m, nil
+}
+
+func WithMemory(memory *Memory) func(*Options) {
+	return func(opt *Options) {
+		opt.Memory = memory
+	}
+}
+
+func normalizeMemoryText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// readMemoryEntries parses every json lines entry of r, or none on error
+func readMemoryEntries(r io.Reader) ([]MemoryEntry, error) {
+	var loaded []MemoryEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var entry MemoryEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, err
+		}
+		entry.Text = normalizeMemoryText(entry.Text)
+		loaded = append(loaded, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+func (m *Memory) store(entries []MemoryEntry) {
+	for _, entry := range entries {
+		m.entries[entry.key()] = entry
+	}
+}
+
+// Get looks up a translation
+func (m *Memory) Get(backend, src, dest, text string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[memoryKey{backend, src, dest, normalizeMemoryText(text)}]
+	return entry.Translation, ok
+}
+
+// Put stores translations, appending them to the memory file
+func (m *Memory) Put(entries ...MemoryEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range entries {
+		entries[i].Text = normalizeMemoryText(entries[i].Text)
+		if entries[i].CreatedAt.IsZero() {
+			entries[i].CreatedAt = time.Now().UTC()
+		}
+		m.entries[entries[i].key()] = entries[i]
+	}
+	return m.append(entries)
+}
+
+func (m *Memory) append(entries []MemoryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(m.path, fileEditFlag, 0666)
+	if err != nil {
+		return err
+	}
+	if err = writeMemoryEntries(file, entries); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeMemoryEntries(w io.Writer, entries []MemoryEntry) error {
+	datawriter := bufio.NewWriter(w)
+	encoder := json.NewEncoder(datawriter)
+	encoder.SetEscapeHTML(false)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return datawriter.Flush()
+}
+
+// Entries returns every stored translation, sorted by language pair and text
+func (m *Memory) Entries() []MemoryEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := make([]MemoryEntry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Backend != b.Backend {
+			return a.Backend < b.Backend
+		}
+		if a.Src != b.Src {
+			return a.Src < b.Src
+		}
+		if a.Dest != b.Dest {
+			return a.Dest < b.Dest
+		}
+		return a.Text < b.Text
+	})
+	return entries
+}
+
+// Export writes every entry as json lines, the same format Import reads
+func (m *Memory) Export(w io.Writer) error {
+	return writeMemoryEntries(w, m.Entries())
+}
+
+// Import merges the json lines entries read from r, overwriting the
+// translations of existing keys. It returns the number of imported entries
+func (m *Memory) Import(r io.Reader) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	loaded, err := readMemoryEntries(r)
+	if err != nil {
+		return 0, fmt.Errorf("[memory] import: %w", err)
+	}
+	m.store(loaded)
+	return len(loaded), m.append(loaded)
+}
+
+// Purge removes the entries matching backend, src and dest. Empty values
+// match anything, so Purge("", "", "") empties the memory. It returns the
+// number of removed entries
+func (m *Memory) Purge(backend, src, dest string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	match := func(filter, value string) bool {
+		return len(filter) == 0 || filter == value
+	}
+	var kept []MemoryEntry
+	removed := 0
+	for key, entry := range m.entries {
+		if match(backend, entry.Backend) && match(src, entry.Src) && match(dest, entry.Dest) {
+			delete(m.entries, key)
+			removed++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// rewrites the file, which also drops overwritten entries
+	tmpPath := m.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	if err = writeMemoryEntries(file, kept); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err = file.Close(); err != nil {
+		return 0, err
+	}
+	return removed, os.Rename(tmpPath, m.path)
+}
+
+// translateSegments only sends to the translator the segments missing from
+// the memory and stores their translations. A nil memory translates all
+func (m *Memory) translateSegments(ctx context.Context, segments []Segment, backend, src, dest string, translator Translator, stats *translationStats) []Segment {
+	if m == nil {
+		return translateSegments(ctx, segments, src, dest, translator, stats)
+	}
+
+	translateds := make([]Segment, len(segments))
+	var misses []Segment
+	var missIdxs []int
+	for i, seg := range segments {
+		if translation, ok := m.Get(backend, src, dest, seg.Text); ok {
+			translateds[i] = Segment{ID: seg.ID, Text: translation}
+			stats.addCached(seg.ID)
+			continue
+		}
+		misses = append(misses, seg)
+		missIdxs = append(missIdxs, i)
+	}
+	if len(misses) == 0 {
+		return translateds
+	}
+
+	var entries []MemoryEntry
+	for i, seg := range translateSegments(ctx, misses, src, dest, translator, stats) {
+		translateds[missIdxs[i]] = seg
+		// untranslated fallbacks are not worth remembering
+		if seg.Text == misses[i].Text {
+			continue
+		}
+		entries = append(entries, MemoryEntry{
+			Backend:     backend,
+			Src:         src,
+			Dest:        dest,
+			Text:        misses[i].Text,
+			Translation: seg.Text,
+		})
+	}
+	if err := m.Put(entries...); err != nil {
+		log.Println("[memory]", err)
+	}
+	return translateds
+}
@@ -0,0 +1,85 @@
+package transub
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemory_translateSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.jsonl")
+	memory, err := OpenMemory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segments := []Segment{{ID: 0, Text: "Previously on..."}, {ID: 1, Text: "[door opens]"}}
+	tr := &mangleTranslator{}
+	got := memory.translateSegments(context.Background(), segments, BackendCustom, "en", "pt", tr, nil)
+	if got[0].Text != "PREVIOUSLY ON..." || got[1].Text != "[DOOR OPENS]" || len(tr.requests) != 1 {
+		t.Fatalf("unexpected first translation %+v, %d requests", got, len(tr.requests))
+	}
+
+	// reopened, with a new line and extra spaces on a remembered one
+	if memory, err = OpenMemory(path); err != nil {
+		t.Fatal(err)
+	}
+	tr = &mangleTranslator{}
+	segments = []Segment{{ID: 0, Text: "Previously  on..."}, {ID: 1, Text: "Hello"}}
+	got = memory.translateSegments(context.Background(), segments, BackendCustom, "en", "pt", tr, nil)
+	if got[0].Text != "PREVIOUSLY ON..." || got[1].Text != "HELLO" {
+		t.Errorf("unexpected translation %+v", got)
+	}
+	if len(tr.requests) != 1 || tr.requests[0] != "Hello" {
+		t.Errorf("only the miss should be sent, got %q", tr.requests)
+	}
+	if _, ok := memory.Get(BackendCustom, "en", "es", "Hello"); ok {
+		t.Error("language pair is part of the key")
+	}
+}
+
+func TestMemory_ExportImportPurge(t *testing.T) {
+	dir := t.TempDir()
+	memory, _ := OpenMemory(filepath.Join(dir, "a.jsonl"))
+	memory.Put(
+		MemoryEntry{Backend: BackendGoogle, Src: "en", Dest: "pt", Text: "Hi", Translation: "Oi"},
+		MemoryEntry{Backend: BackendDeepL, Src: "en", Dest: "es", Text: "Hi", Translation: "Hola"},
+	)
+
+	var buf bytes.Buffer
+	if err := memory.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := OpenMemory(filepath.Join(dir, "b.jsonl"))
+	if imported, err := other.Import(&buf); err != nil || imported != 2 {
+		t.Fatalf("imported %d entries: %v", imported, err)
+	}
+
+	if purged, err := other.Purge(BackendDeepL, "", ""); err != nil || purged != 1 {
+		t.Fatalf("purged %d entries: %v", purged, err)
+	}
+	reopened, _ := OpenMemory(filepath.Join(dir, "b.jsonl"))
+	entries := reopened.Entries()
+	if len(entries) != 1 || entries[0].Translation != "Oi" {
+		t.Errorf("unexpected entries after purge %+v", entries)
+	}
+}
+
+func TestMemory_ImportBadLine(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "a.jsonl")
+	memory, _ := OpenMemory(filename)
+	input := `{"backend":"google","src":"en","dest":"pt","text":"Hi","translation":"Oi"}
+{"backend":"google","src":"en","dest":"pt","text":"Bye",`
+	if _, err := memory.Import(strings.NewReader(input)); err == nil {
+		t.Fatal("expected an error on the bad line")
+	}
+	if _, ok := memory.Get(BackendGoogle, "en", "pt", "Hi"); ok {
+		t.Error("the entries before the bad line were added")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("the memory file was written: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package transub
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ReflowCfg rebalances the translated cues into at most MaxLines lines of
+// at most MaxChars characters and reports the cues read faster than MaxCPS
+// characters per second. Zero limits are taken from Preset. Without one,
+// lines default to the "netflix" limits and the report is off
+type ReflowCfg struct {
+	// Enabled turns the reflow on
+	Enabled bool
+	// Preset name, eg: "netflix", "bbc"
+	Preset   string
+	MaxLines int
+	MaxChars int
+	// MaxCPS is the reading speed limit, in characters per second
+	MaxCPS float64
+}
+
+// ReflowIssue is a cue that still breaks the limits after the reflow
+type ReflowIssue struct {
+	// Index is the cue number as the file shows it, its 1-based position on
+	// formats without numbers
+	Index    int
+	Start    time.Duration
+	Lines    int
+	MaxChars int
+	CPS      float64
+}
+
+var reflowPresets = map[string]ReflowCfg{
+	"netflix": {MaxLines: 2, MaxChars: 42, MaxCPS: 17},
+	"bbc":     {MaxLines: 2, MaxChars: 37, MaxCPS: 15},
+}
+
+func WithReflow(cfg ReflowCfg) func(*Options) {
+	return func(opt *Options) {
+		opt.Reflow = cfg
+	}
+}
+
+// ReflowPreset returns the limits of a named preset
+func ReflowPreset(name string) (ReflowCfg, bool) {
+	cfg, ok := reflowPresets[strings.ToLower(strings.TrimSpace(name))]
+	cfg.Enabled = ok
+	return cfg, ok
+}
+
+// limits fills the zero limits from the preset
+func (cfg ReflowCfg) limits() ReflowCfg {
+	preset, ok := ReflowPreset(cfg.Preset)
+	if !ok {
+		if len(cfg.Preset) > 0 {
+			log.Printf("[reflow] unknown preset '%s', using netflix", cfg.Preset)
+		}
+		preset, _ = ReflowPreset("netflix")
+	}
+	if cfg.MaxLines <= 0 {
+		cfg.MaxLines = preset.MaxLines
+	}
+	if cfg.MaxChars <= 0 {
+		cfg.MaxChars = preset.MaxChars
+	}
+	if cfg.MaxCPS <= 0 && len(cfg.Preset) > 0 {
+		cfg.MaxCPS = preset.MaxCPS
+	}
+	return cfg
+}
+
+func (issue ReflowIssue) String() string {
+	var problems []string
+	if issue.Lines > 0 {
+		problems = append(problems, fmt.Sprintf("%d lines", issue.Lines))
+	}
+	if issue.MaxChars > 0 {
+		problems = append(problems, fmt.Sprintf("%d characters line", issue.MaxChars))
+	}
+	if issue.CPS > 0 {
+		problems = append(problems, fmt.Sprintf("%.1f characters per second", issue.CPS))
+	}
+	return fmt.Sprintf("[reflow] cue %d at %s: %s", issue.Index, issue.Start, strings.Join(problems, ", "))
+}
+
+// Reflow breaks the text of every translatable cue into balanced lines
+// within the cfg limits, at natural points when it can. Dialogue cues, one
+// speaker per line, keep their lines. It returns the cues still over the
+// limits
+func (doc *Document) Reflow(cfg ReflowCfg) []ReflowIssue {
+	cfg = cfg.limits()
+	tagRe := doc.tagRe()
+	var issues []ReflowIssue
+	for i, cue := range doc.Cues {
+		if !cue.isTranslatable(false) {
+			continue
+		}
+		if !isDialogueCue(cue.Lines, tagRe) {
+			cue.Lines = reflowLines(cue.Lines, tagRe, cfg.MaxLines, cfg.MaxChars)
+		}
+
+		issue := ReflowIssue{Index: doc.cueNumber(i), Start: cue.Start}
+		chars := 0
+		for _, line := range cue.Lines {
+			lineChars := visibleLen(line, tagRe)
+			chars += lineChars
+			if lineChars > cfg.MaxChars && lineChars > issue.MaxChars {
+				issue.MaxChars = lineChars
+			}
+		}
+		if len(cue.Lines) > cfg.MaxLines {
+			issue.Lines = len(cue.Lines)
+		}
+		if seconds := (cue.End - cue.Start).Seconds(); cfg.MaxCPS > 0 && seconds > 0 {
+			if cps := float64(chars) / seconds; cps > cfg.MaxCPS {
+				issue.CPS = math.Round(cps*10) / 10
+			}
+		}
+		if issue.Lines > 0 || issue.MaxChars > 0 || issue.CPS > 0 {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func visibleLen(text string, tagRe *regexp.Regexp) int {
+	if tagRe != nil {
+		text = tagRe.ReplaceAllString(text, "")
+	}
+	return utf8.RuneCountInString(text)
+}
+
+// isDialogueCue checks for "- Hi" / "- Hello" cues
+func isDialogueCue(lines []string, tagRe *regexp.Regexp) bool {
+	if len(lines) < 2 {
+		return false
+	}
+	for _, line := range lines {
+		if tagRe != nil {
+			line = tagRe.ReplaceAllString(line, "")
+		}
+		if !strings.HasPrefix(strings.TrimSpace(line), "-") {
+			return false
+		}
+	}
+	return true
+}
+
+// reflowLines uses the fewest lines the text fits in. When it does not fit
+// in maxLines, the longest line is kept as short as it gets
+func reflowLines(lines []string, tagRe *regexp.Regexp, maxLines, maxChars int) []string {
+	words := strings.Fields(strings.Join(lines, " "))
+	if len(words) == 0 {
+		return lines
+	}
+	lens := make([]int, len(words))
+	total := len(words) - 1
+	for i, word := range words {
+		lens[i] = visibleLen(word, tagRe)
+		total += lens[i]
+	}
+	if total <= maxChars {
+		return []string{strings.Join(words, " ")}
+	}
+
+	minLines := (total + maxChars - 1) / maxChars
+	if minLines < 2 {
+		minLines = 2
+	}
+	for count := minLines; count <= maxLines && count <= len(words); count++ {
+		if broken, fits := breakWords(words, lens, count, maxChars); fits {
+			return broken
+		}
+	}
+	count := maxLines
+	if count > len(words) {
+		count = len(words)
+	}
+	broken, _ := breakWords(words, lens, count, maxChars)
+	return broken
+}
+
+// breakWords splits words in count lines minimizing the sum of the squared
+// line lengths, which balances them. Breaking after a punctuation mark is
+// cheaper, going over maxChars is much more expensive
+func breakWords(words []string, lens []int, count, maxChars int) ([]string, bool) {
+	n := len(words)
+	lineLen := func(start, end int) int {
+		size := end - start - 1
+		for _, l := range lens[start:end] {
+			size += l
+		}
+		return size
+	}
+	lineCost := func(start, end int, isLast bool) float64 {
+		size := lineLen(start, end)
+		cost := float64(size * size)
+		if size > maxChars {
+			cost += 1e6 * float64(size-maxChars)
+		}
+		if !isLast && strings.ContainsAny(words[end-1][len(words[end-1])-1:], ",;:.!?") {
+			cost -= float64(maxChars * 2)
+		}
+		return cost
+	}
+
+	// costs[k][i] is the best cost of the first i words in k lines
+	costs := make([][]float64, count+1)
+	breaks := make([][]int, count+1)
+	for k := range costs {
+		costs[k] = make([]float64, n+1)
+		breaks[k] = make([]int, n+1)
+		for i := range costs[k] {
+			costs[k][i] = math.Inf(1)
+		}
+	}
+	costs[0][0] = 0
+	for k := 1; k <= count; k++ {
+		for i := k; i <= n; i++ {
+			for j := k - 1; j < i; j++ {
+				if math.IsInf(costs[k-1][j], 1) {
+					continue
+				}
+				cost := costs[k-1][j] + lineCost(j, i, k == count)
+				if cost < costs[k][i] {
+					costs[k][i], breaks[k][i] = cost, j
+				}
+			}
+		}
+	}
+
+	broken := make([]string, count)
+	fits := true
+	end := n
+	for k := count; k > 0; k-- {
+		start := breaks[k][end]
+		broken[k-1] = strings.Join(words[start:end], " ")
+		fits = fits && lineLen(start, end) <= maxChars
+		end = start
+	}
+	return broken, fits
+}
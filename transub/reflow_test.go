@@ -0,0 +1,78 @@
+package transub
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocument_Reflow(t *testing.T) {
+	doc, err := ParseDocument(strings.Split(`1
+00:00:01,000 --> 00:00:04,000
+<i>Nunca pensei que voltaríamos, muito menos juntos e tão tarde da noite.</i>
+
+2
+00:00:05,000 --> 00:00:06,000
+Curto.
+
+3
+00:00:07,000 --> 00:00:08,000
+- Você viu o que aconteceu ontem à noite no porto?
+- Não.
+
+4
+00:00:09,000 --> 00:00:11,000
+Isto é
+dividido à toa.`, "\n"), FormatSRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues := doc.Reflow(ReflowCfg{Enabled: true, Preset: "netflix"})
+
+	want := [][]string{
+		{"<i>Nunca pensei que voltaríamos,", "muito menos juntos e tão tarde da noite.</i>"},
+		{"Curto."},
+		{"- Você viu o que aconteceu ontem à noite no porto?", "- Não."},
+		{"Isto é dividido à toa."},
+	}
+	for i, lines := range want {
+		if strings.Join(doc.Cues[i].Lines, "|") != strings.Join(lines, "|") {
+			t.Errorf("cue %d: got %q, want %q", i, doc.Cues[i].Lines, lines)
+		}
+	}
+
+	// the dialogue keeps a 50 characters line and is read at 56 cps
+	// indexes are the cue numbers, as the file shows them
+	if len(issues) != 2 || issues[0].Index != 1 || issues[0].CPS != 23 {
+		t.Fatalf("unexpected issues %+v", issues)
+	}
+	if issues[1].Index != 3 || issues[1].MaxChars != 50 || issues[1].CPS == 0 {
+		t.Errorf("unexpected dialogue issue %+v", issues[1])
+	}
+
+	// ASS dialogues have no numbers, their position is reported
+	ass, err := ParseDocument(strings.Split(`[Script Info]
+ScriptType: v4.00+
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Curto.
+Dialogue: 0,0:00:03.00,0:00:03.50,Default,,0,0,0,,Rápido demais para ler.`, "\n"), FormatASS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues = ass.Reflow(ReflowCfg{Enabled: true, Preset: "netflix"})
+	if len(issues) != 1 || issues[0].Index != 2 {
+		t.Errorf("unexpected ASS issues %+v", issues)
+	}
+}
+
+func TestReflowPreset(t *testing.T) {
+	cfg, ok := ReflowPreset("Netflix")
+	if !ok || !cfg.Enabled || cfg.MaxChars != 42 || cfg.MaxCPS != 17 {
+		t.Errorf("unexpected netflix preset %+v", cfg)
+	}
+	if _, ok = ReflowPreset("unknown"); ok {
+		t.Error("unknown preset found")
+	}
+}
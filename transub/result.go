@@ -0,0 +1,184 @@
+package transub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrAlreadyTranslated is a source marked as translated or named like a
+	// translation
+	ErrAlreadyTranslated = errors.New("[transub] file already translated")
+	// ErrOutputExists is an output file that would be overwritten
+	ErrOutputExists = errors.New("[transub] output file already exists")
+	// ErrNotSubtitle is an empty, binary or unsupported file
+	ErrNotSubtitle = errors.New("[transub] not a subtitle file")
+)
+
+// Result tells how a translation went. Cue counts add up every target
+// language
+type Result struct {
+	// OutputFile is the first written file, after ManageOriginDestFiles
+	OutputFile string
+	// OutputFiles has every written file, in LanguagesDest order
+	OutputFiles []string
+	// SourceLanguage is the detected source language and Confidence how sure
+	// the backend is about it, from 0 to 1
+	SourceLanguage string
+	Confidence     float64
+	// Translated cues got their translation from the backend, Cached ones
+	// from the Memory. Failed cues were kept untranslated, Skipped ones had
+	// nothing to translate
+	Translated int
+	Cached     int
+	Failed     int
+	Skipped    int
+	// CharsSent is the number of characters sent to the backend
+	CharsSent int
+	Backend   string
+	Duration  time.Duration
+	Warnings  []Warning
+}
+
+type WarningKind string
+
+const (
+	// WarnLanguageMismatch is a detected source language other than the
+	// WithLanguageSrc one
+	WarnLanguageMismatch WarningKind = "language_mismatch"
+	// WarnDetectionFailed keeps the WithLanguageSrc language
+	WarnDetectionFailed WarningKind = "detection_failed"
+	// WarnSameLanguage is a target language skipped for being the source one
+	WarnSameLanguage WarningKind = "same_language"
+	// WarnOutputExists is a target language skipped for its existing output
+	WarnOutputExists WarningKind = "output_exists"
+	// WarnUntranslated is a segment kept untranslated
+	WarnUntranslated WarningKind = "untranslated"
+	// WarnReflow is a cue still over the WithReflow limits
+	WarnReflow WarningKind = "reflow"
+	// WarnLanguageFailed is a target language which translation failed
+	// while others were written
+	WarnLanguageFailed WarningKind = "language_failed"
+	// WarnGlossaryTermLost is a glossary term the translator dropped
+	WarnGlossaryTermLost WarningKind = "glossary_term_lost"
+	// WarnEncodingFallback is an output written as UTF-8 because the
+	// WithOutputEncoding one can not hold its text
+	WarnEncodingFallback WarningKind = "encoding_fallback"
+)
+
+// Warning is a problem that did not stop the translation
+type Warning struct {
+	Kind WarningKind
+	// Lang is the target language it happened on, empty for the source
+	Lang    string
+	Message string
+}
+
+func (w Warning) String() string {
+	if len(w.Lang) > 0 {
+		return fmt.Sprintf("[%s] %s: %s", w.Kind, w.Lang, w.Message)
+	}
+	return fmt.Sprintf("[%s] %s", w.Kind, w.Message)
+}
+
+func (res *Result) String() string {
+	return fmt.Sprintf(
+		"[transub] %s from '%s' (%.2f) with %s in %s: %d cues translated, %d cached, %d failed, %d skipped, %d characters sent",
+		strings.Join(res.OutputFiles, ", "), res.SourceLanguage, res.Confidence, res.Backend,
+		res.Duration.Round(time.Millisecond), res.Translated, res.Cached, res.Failed, res.Skipped, res.CharsSent,
+	)
+}
+
+func (res *Result) warn(kind WarningKind, lang, format string, a ...any) {
+	res.Warnings = append(res.Warnings, Warning{Kind: kind, Lang: lang, Message: fmt.Sprintf(format, a...)})
+}
+
+// add sums the counts and warnings of a target language
+func (res *Result) add(langRes *Result) {
+	if langRes == nil {
+		return
+	}
+	res.Translated += langRes.Translated
+	res.Cached += langRes.Cached
+	res.Failed += langRes.Failed
+	res.Skipped += langRes.Skipped
+	res.CharsSent += langRes.CharsSent
+	res.Warnings = append(res.Warnings, langRes.Warnings...)
+}
+
+// translationStats is filled by the concurrent batches of one target
+// language. A nil one counts nothing
+type translationStats struct {
+	mu        sync.Mutex
+	cached    []int
+	failed    []int
+	charsSent int
+}
+
+func (stats *translationStats) addCached(ids ...int) {
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.cached = append(stats.cached, ids...)
+}
+
+func (stats *translationStats) addFailed(id int) {
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.failed = append(stats.failed, id)
+}
+
+func (stats *translationStats) addSent(texts ...string) {
+	if stats == nil {
+		return
+	}
+	chars := 0
+	for _, text := range texts {
+		chars += utf8.RuneCountInString(text)
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.charsSent += chars
+}
+
+// forget drops the cached and failed counts of ids, translated again
+func (stats *translationStats) forget(ids ...int) {
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	drop := map[int]bool{}
+	for _, id := range ids {
+		drop[id] = true
+	}
+	stats.cached = removeIDs(stats.cached, drop)
+	stats.failed = removeIDs(stats.failed, drop)
+}
+
+func removeIDs(ids []int, drop map[int]bool) []int {
+	var kept []int
+	for _, id := range ids {
+		if !drop[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+func sentSegments(segments []Segment) []string {
+	texts := make([]string, len(segments))
+	for i, seg := range segments {
+		texts[i] = seg.Text
+	}
+	return texts
+}
@@ -0,0 +1,126 @@
+package transub
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type failTranslator struct {
+	fakeTranslator
+}
+
+func (f failTranslator) Translate(text, src, dest string) (string, error) {
+	return "", errors.New("backend down")
+}
+
+func TestTransub_Result(t *testing.T) {
+	memory, err := OpenMemory(filepath.Join(t.TempDir(), "memory.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := copyExample(t, "subtitle.srt")
+	tr := New(filename, "pt", WithTranslator(fakeTranslator{lang: "en"}), WithLanguageSrc("es"), WithMemory(memory))
+	res, err := tr.TranslasteSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SourceLanguage != "en" || res.Confidence != 1 || res.Backend != BackendCustom {
+		t.Errorf("unexpected detection %+v", res)
+	}
+	if res.Translated == 0 || res.Cached != 0 || res.Failed != 0 || res.CharsSent == 0 || res.Duration <= 0 {
+		t.Errorf("unexpected counts %+v", res)
+	}
+	if res.OutputFile != tr.OutputFile || len(res.OutputFiles) != 1 {
+		t.Errorf("unexpected outputs %q, %q", res.OutputFile, res.OutputFiles)
+	}
+	if len(res.Warnings) != 1 || res.Warnings[0].Kind != WarnLanguageMismatch {
+		t.Errorf("expected a language mismatch warning, got %v", res.Warnings)
+	}
+
+	// the same texts again come from the memory
+	other := copyExample(t, "subtitle.srt")
+	cached, err := New(other, "pt", WithTranslator(fakeTranslator{lang: "en"}), WithMemory(memory)).TranslasteSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Cached != res.Translated || cached.Translated != 0 || cached.Skipped != res.Skipped {
+		t.Errorf("expected %d cached cues, got %+v", res.Translated, cached)
+	}
+
+	failed, err := New(copyExample(t, "subtitle.srt"), "pt", WithTranslator(failTranslator{fakeTranslator{lang: "en"}})).TranslasteSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Failed != res.Translated || failed.Translated != 0 || len(failed.Warnings) != 1 || failed.Warnings[0].Kind != WarnUntranslated {
+		t.Errorf("expected %d failed cues, got %+v", res.Translated, failed)
+	}
+}
+
+func TestTransub_Errors(t *testing.T) {
+	filename := copyExample(t, "subtitle.srt")
+	tr := New(filename, "pt", WithTranslator(fakeTranslator{lang: "en"}))
+	if _, err := tr.TranslasteSRT(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.TranslasteSRT(); !errors.Is(err, ErrOutputExists) {
+		t.Errorf("expected ErrOutputExists, got %v", err)
+	}
+	if _, err := New(filename, "es", WithTranslator(fakeTranslator{lang: "en"})).TranslasteSRT(); !errors.Is(err, ErrAlreadyTranslated) {
+		t.Errorf("expected ErrAlreadyTranslated, got %v", err)
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.srt")
+	if err := os.WriteFile(empty, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(empty, "pt", WithTranslator(fakeTranslator{lang: "en"})).TranslasteSRT(); !errors.Is(err, ErrNotSubtitle) {
+		t.Errorf("expected ErrNotSubtitle, got %v", err)
+	}
+}
+
+// lossyTranslator drops the glossary placeholders and writes letters
+// windows-1252 has no room for
+type lossyTranslator struct {
+	fakeTranslator
+}
+
+func (l lossyTranslator) Translate(text, src, dest string) (string, error) {
+	text = glossaryPlaceholderRe.ReplaceAllString(text, "")
+	return strings.ReplaceAll(strings.ToUpper(text), "O", "Ж"), nil
+}
+
+func TestTransub_ResultWarnings(t *testing.T) {
+	filename := copyExample(t, "subtitle.srt")
+	tr := New(filename, "pt",
+		WithTranslator(lossyTranslator{fakeTranslator{lang: "en"}}),
+		WithGlossary(&Glossary{DoNotTranslate: []string{"Hello"}}),
+		WithOutputEncoding(EncodingWindows1252),
+	)
+	res, err := tr.TranslasteSRT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[WarningKind]Warning{}
+	for _, warning := range res.Warnings {
+		kinds[warning.Kind] = warning
+	}
+	if warning, ok := kinds[WarnGlossaryTermLost]; !ok || warning.Lang != "pt" || !strings.Contains(warning.Message, "'Hello'") {
+		t.Errorf("expected a lost 'Hello' warning, got %v", res.Warnings)
+	}
+	if warning, ok := kinds[WarnEncodingFallback]; !ok || warning.Lang != "pt" {
+		t.Errorf("expected an encoding fallback warning, got %v", res.Warnings)
+	}
+
+	// the UTF-8 fallback keeps the BOM setting, none for windows-1252
+	out, err := os.ReadFile(res.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(out, bomUTF8) || !strings.Contains(string(out), "WЖRLD") {
+		t.Errorf("expected UTF-8 without BOM, got %q", out[:16])
+	}
+}
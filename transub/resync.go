@@ -0,0 +1,297 @@
+package transub
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ResyncReport tells how a Resync went. Pieces is the number of stretches
+// of cues sharing the same offset, more than one when scenes were cut or
+// inserted between the releases
+type ResyncReport struct {
+	Matched   int
+	Unmatched int
+	Pieces    int
+}
+
+const (
+	// a match must score above this to win over skipping both cues
+	resyncMinScore = 0.6
+	// offset changes up to resyncOffsetTolerance are the same piece
+	resyncOffsetTolerance = time.Second
+)
+
+// resyncCue is what a cue is compared by. Translated and reference texts
+// are in different languages, so only numbers, names and punctuation are
+// compared along with the timing
+type resyncCue struct {
+	cue      *Cue
+	duration time.Duration
+	gap      time.Duration
+	length   int
+	tokens   map[string]bool
+}
+
+// Resync moves the cues of doc onto the reference timings. Cues are matched
+// in order by duration, distance to the previous cue, text length, numbers
+// and names. There is no global offset, it can change where scenes were
+// added or removed. Cues without a match keep the offset of the nearest
+// matched cue before them
+func (doc *Document) Resync(reference *Document) ResyncReport {
+	cues := resyncCues(doc)
+	refs := resyncCues(reference)
+	matches := alignResyncCues(cues, refs)
+
+	report := ResyncReport{}
+	// cues before the first match use its offset
+	var offset time.Duration
+	for i, j := range matches {
+		if j >= 0 {
+			offset = refs[j].cue.Start - cues[i].cue.Start
+			break
+		}
+	}
+
+	isFirstMatch := true
+	for i, rc := range cues {
+		j := matches[i]
+		if j < 0 {
+			report.Unmatched++
+			rc.cue.Start = clampTime(rc.cue.Start + offset)
+			rc.cue.End = clampTime(rc.cue.End + offset)
+			continue
+		}
+		matchOffset := refs[j].cue.Start - rc.cue.Start
+		if isFirstMatch || absDuration(matchOffset-offset) > resyncOffsetTolerance {
+			report.Pieces++
+		}
+		isFirstMatch = false
+		offset = matchOffset
+		report.Matched++
+		rc.cue.Start, rc.cue.End = refs[j].cue.Start, refs[j].cue.End
+	}
+	return report
+}
+
+func resyncCues(doc *Document) []resyncCue {
+	tagRe := doc.tagRe()
+	var cues []resyncCue
+	var prevEnd time.Duration
+	for _, cue := range doc.Cues {
+		kind := cue.Meta[metaKind]
+		if cue.Meta[metaRaw] == "true" || (len(kind) > 0 && kind != ssaDialogueKind) {
+			continue
+		}
+		text := strings.Join(cue.Lines, " ")
+		if tagRe != nil {
+			text = tagRe.ReplaceAllString(text, "")
+		}
+		gap := cue.Start - prevEnd
+		if len(cues) == 0 || gap < 0 {
+			gap = 0
+		}
+		prevEnd = cue.End
+		cues = append(cues, resyncCue{
+			cue:      cue,
+			duration: cue.End - cue.Start,
+			gap:      gap,
+			length:   len([]rune(strings.TrimSpace(text))),
+			tokens:   resyncTokens(text),
+		})
+	}
+	return cues
+}
+
+// resyncTokens are the parts of a text that survive a translation: numbers,
+// capitalized words in the middle of a sentence and the ending punctuation
+func resyncTokens(text string) map[string]bool {
+	tokens := map[string]bool{}
+	sentenceStart := true
+	for _, word := range strings.Fields(text) {
+		trimmed := strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(trimmed) > 0 {
+			first := []rune(trimmed)[0]
+			if unicode.IsDigit(first) {
+				tokens[trimmed] = true
+			} else if unicode.IsUpper(first) && !sentenceStart && len(trimmed) > 1 {
+				tokens[strings.ToLower(trimmed)] = true
+			}
+		}
+		sentenceStart = strings.ContainsAny(word[len(word)-1:], ".!?-")
+	}
+	text = strings.TrimSpace(text)
+	if strings.HasSuffix(text, "?") {
+		tokens["?"] = true
+	}
+	if strings.HasSuffix(text, "!") {
+		tokens["!"] = true
+	}
+	return tokens
+}
+
+func similarRatio(a, b float64) float64 {
+	if a <= 0 && b <= 0 {
+		return 1
+	}
+	return math.Min(a, b) / math.Max(a, b)
+}
+
+func resyncSimilarity(a, b resyncCue) float64 {
+	durationSim := similarRatio(a.duration.Seconds(), b.duration.Seconds())
+	// short gaps are all alike, a 100ms difference means nothing
+	gapSim := 1 - math.Min(1, math.Abs((a.gap-b.gap).Seconds())/math.Max(0.5, math.Max(a.gap.Seconds(), b.gap.Seconds())))
+	lengthSim := similarRatio(float64(a.length), float64(b.length))
+
+	tokenSim := 0.5
+	if len(a.tokens) > 0 || len(b.tokens) > 0 {
+		shared := 0
+		for token := range a.tokens {
+			if b.tokens[token] {
+				shared++
+			}
+		}
+		tokenSim = float64(shared) / float64(len(a.tokens)+len(b.tokens)-shared)
+	}
+	return 0.35*durationSim + 0.25*gapSim + 0.2*lengthSim + 0.2*tokenSim
+}
+
+// alignResyncCues returns, for each cue, the reference it matches or -1.
+// It is an edit distance like alignment where both sides can skip cues,
+// followed by dropMisplacedMatches
+func alignResyncCues(cues, refs []resyncCue) []int {
+	n, m := len(cues), len(refs)
+	const (
+		moveNone = iota
+		moveMatch
+		moveSkipCue
+		moveSkipRef
+	)
+	scores := make([][]float64, n+1)
+	moves := make([][]uint8, n+1)
+	for i := range scores {
+		scores[i] = make([]float64, m+1)
+		moves[i] = make([]uint8, m+1)
+	}
+
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= m; j++ {
+			if i == 0 && j == 0 {
+				continue
+			}
+			best, move := math.Inf(-1), uint8(moveNone)
+			if i > 0 && scores[i-1][j] > best {
+				best, move = scores[i-1][j], moveSkipCue
+			}
+			if j > 0 && scores[i][j-1] > best {
+				best, move = scores[i][j-1], moveSkipRef
+			}
+			if i > 0 && j > 0 {
+				score := resyncSimilarity(cues[i-1], refs[j-1]) - resyncMinScore
+				if score > 0 && scores[i-1][j-1]+score > best {
+					best, move = scores[i-1][j-1]+score, moveMatch
+				}
+			}
+			scores[i][j], moves[i][j] = best, move
+		}
+	}
+
+	matches := make([]int, n)
+	for i := range matches {
+		matches[i] = -1
+	}
+	for i, j := n, m; i > 0 || j > 0; {
+		switch moves[i][j] {
+		case moveMatch:
+			matches[i-1] = j - 1
+			i, j = i-1, j-1
+		case moveSkipCue:
+			i--
+		default:
+			j--
+		}
+	}
+	dropMisplacedMatches(cues, refs, matches)
+	return matches
+}
+
+// dropMisplacedMatches removes the matches which offset agrees with neither
+// the previous nor the next match. A real piece has at least two cues
+func dropMisplacedMatches(cues, refs []resyncCue, matches []int) {
+	var matched []int
+	for i, j := range matches {
+		if j >= 0 {
+			matched = append(matched, i)
+		}
+	}
+	if len(matched) < 2 {
+		return
+	}
+	offset := func(i int) time.Duration {
+		return refs[matches[i]].cue.Start - cues[i].cue.Start
+	}
+	var misplaced []int
+	for k, i := range matched {
+		agrees := k > 0 && absDuration(offset(i)-offset(matched[k-1])) <= resyncOffsetTolerance
+		agrees = agrees || k+1 < len(matched) && absDuration(offset(i)-offset(matched[k+1])) <= resyncOffsetTolerance
+		if !agrees {
+			misplaced = append(misplaced, i)
+		}
+	}
+	for _, i := range misplaced {
+		matches[i] = -1
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// ResyncFile writes a copy of filename retimed to the reference subtitle,
+// named file.synced.ext
+func ResyncFile(filename, referenceFile string) (string, ResyncReport, error) {
+	var report ResyncReport
+	docs := make([]*Document, 2)
+	var enc textEncoding
+	for i, name := range []string{filename, referenceFile} {
+		format, ok := FormatFromFilename(name)
+		if !ok {
+			return "", report, fmt.Errorf("%w: %s", ErrNotSubtitle, name)
+		}
+		fileLines, fileEnc, err := readTextFile(name)
+		if err != nil {
+			return "", report, err
+		}
+		if docs[i], err = ParseDocument(fileLines, format); err != nil {
+			return "", report, err
+		}
+		if i == 0 {
+			enc = fileEnc
+		}
+	}
+	report = docs[0].Resync(docs[1])
+	if report.Matched == 0 {
+		return "", report, fmt.Errorf("[transub] no cue of %s matches %s", filename, referenceFile)
+	}
+
+	// the extension may be in any case, eg: movie.SRT
+	ext := filepath.Ext(filename)
+	output := removeFileExtension(filename, ext) + ".synced" + ext
+	if _, err := os.Stat(output); err == nil {
+		return "", report, fmt.Errorf("%w: %s", ErrOutputExists, output)
+	}
+	data, err := encodeLines(docs[0].Lines(), enc)
+	if err != nil {
+		return "", report, err
+	}
+	return output, report, os.WriteFile(output, data, 0666)
+}
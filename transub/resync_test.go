@@ -0,0 +1,95 @@
+package transub
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func srtDoc(t *testing.T, starts []time.Duration, durations []time.Duration, texts []string) *Document {
+	t.Helper()
+	var lines []string
+	for i, text := range texts {
+		lines = append(lines, fmt.Sprint(i+1),
+			formatSRTTimestamp(starts[i])+" --> "+formatSRTTimestamp(starts[i]+durations[i]), text, "")
+	}
+	doc, err := ParseDocument(lines, FormatSRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDocument_Resync(t *testing.T) {
+	sec := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+	refTexts := []string{
+		"Where is John?", "He left at 10.", "That's not like him.", "Call Mary, now!",
+		"I already did.", "She didn't answer.", "We go to Boston tomorrow.", "Fine.",
+	}
+	trTexts := []string{
+		"Cadê o John?", "Ele saiu às 10.", "Não é do feitio dele.", "Liga pra Mary, já!",
+		"Já liguei.", "Ela não atendeu.", "Uma cena extra.", "Amanhã vamos pra Boston.", "Certo.",
+	}
+	refStarts := []time.Duration{sec(10), sec(12.5), sec(15), sec(19), sec(60), sec(62), sec(66), sec(70)}
+	refDurations := []time.Duration{sec(2), sec(2), sec(3), sec(1.5), sec(1.8), sec(2.5), sec(3), sec(1)}
+	reference := srtDoc(t, refStarts, refDurations, refTexts)
+
+	// 5s late on the first scene, then a 30s scene was cut from the new
+	// release and the old one has a line the new one does not
+	var trStarts, trDurations []time.Duration
+	for i := range refTexts {
+		offset := sec(5)
+		if i >= 4 {
+			offset = sec(35)
+		}
+		trStarts = append(trStarts, refStarts[i]+offset)
+		trDurations = append(trDurations, refDurations[i])
+		if i == 5 {
+			trStarts = append(trStarts, refStarts[i]+offset+sec(2.7))
+			trDurations = append(trDurations, sec(1))
+		}
+	}
+	translated := srtDoc(t, trStarts, trDurations, trTexts)
+
+	report := translated.Resync(reference)
+	if report.Matched != 8 || report.Unmatched != 1 || report.Pieces != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for i, cue := range translated.Cues {
+		refIdx := i
+		if i > 6 {
+			refIdx = i - 1
+		}
+		if i == 6 {
+			// the extra line keeps the offset of the cue before it
+			if want := trStarts[6] - sec(35); cue.Start != want {
+				t.Errorf("unmatched cue starts at %s, want %s", cue.Start, want)
+			}
+			continue
+		}
+		if cue.Start != refStarts[refIdx] || !strings.HasPrefix(cue.Lines[0], trTexts[i][:3]) {
+			t.Errorf("cue %d starts at %s, want %s", i, cue.Start, refStarts[refIdx])
+		}
+	}
+}
+
+func TestResyncFile_ExtensionCase(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("examples", "subtitle.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "movie.SRT")
+	if err = os.WriteFile(filename, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	output, report, err := ResyncFile(filename, filepath.Join("examples", "subtitle.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSuffix(filename, ".SRT") + ".synced.SRT"; output != want || report.Matched == 0 {
+		t.Errorf("got %s %+v, want %s", output, report, want)
+	}
+}
@@ -0,0 +1,199 @@
+package transub
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Plain text translators get a batch as one segment per line, each one
+// prefixed by its id: "[[12]] Hello world!". Texts are sent untouched,
+// the id is the only thing the response is matched by
+const segmentIDFmt = "[[%d]] "
+
+var segmentIDRe = regexp.MustCompile(`^\s*\[\[\s*(\d+)\s*\]\]\s*(.*)$`)
+
+// batchSegments groups segments so each encoded batch stays under charLimit
+func batchSegments(segments []Segment, charLimit int) [][]Segment {
+	var batches [][]Segment
+	var batch []Segment
+	size := 0
+	for _, seg := range segments {
+		segSize := len(fmt.Sprintf(segmentIDFmt, seg.ID)) + len(seg.Text) + len(LN_BREAK)
+		if len(batch) > 0 && size+segSize >= charLimit {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, seg)
+		size += segSize
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+func encodeSegments(batch []Segment) string {
+	var sb strings.Builder
+	for _, seg := range batch {
+		text := strings.ReplaceAll(seg.Text, LN_BREAK, " ")
+		sb.WriteString(fmt.Sprintf(segmentIDFmt, seg.ID) + text + LN_BREAK)
+	}
+	return sb.String()
+}
+
+// decodeSegments reads back an encoded batch. Lines without an id are
+// continuations of the previous segment, as some engines wrap long lines
+func decodeSegments(text string) []Segment {
+	var segments []Segment
+	for _, line := range strings.Split(text, LN_BREAK) {
+		match := segmentIDRe.FindStringSubmatch(line)
+		if match == nil {
+			if line = strings.TrimSpace(line); len(line) > 0 && len(segments) > 0 {
+				last := &segments[len(segments)-1]
+				last.Text = strings.TrimSpace(last.Text + " " + line)
+			}
+			continue
+		}
+		id, _ := strconv.Atoi(match[1])
+		segments = append(segments, Segment{ID: id, Text: strings.TrimSpace(match[2])})
+	}
+	return segments
+}
+
+// alignSegments matches the translated segments to the batch by id. It
+// returns the translations in batch order and the segments that did not
+// come back, came back empty or more than once
+func alignSegments(batch, translated []Segment) (aligned, missing []Segment) {
+	texts := map[int]string{}
+	seen := map[int]int{}
+	for _, seg := range translated {
+		seen[seg.ID]++
+		texts[seg.ID] = seg.Text
+	}
+	for _, seg := range batch {
+		text := texts[seg.ID]
+		if seen[seg.ID] != 1 || len(text) == 0 {
+			missing = append(missing, seg)
+			continue
+		}
+		aligned = append(aligned, Segment{ID: seg.ID, Text: text})
+	}
+	return aligned, missing
+}
+
+// translateSegments translates every segment, batching as many as the
+// translator accepts per request. Segments lost in a batch response are
+// requested again one by one and, if that fails too, kept untranslated.
+// The result has the same order and ids as segments. Once ctx is done the
+// segments left are kept untranslated. stats may be nil
+func translateSegments(ctx context.Context, segments []Segment, src, dest string, translator Translator, stats *translationStats) []Segment {
+	batches := batchSegments(segments, translationCharLimit(translator))
+	segTranslator, isSegTranslator := translator.(SegmentTranslator)
+
+	results := make([][]Segment, len(batches))
+	var wg sync.WaitGroup
+	wg.Add(len(batches))
+	offset := 0
+	for i, batch := range batches {
+		var before, after []Segment
+		if isSegTranslator {
+			before, after = segmentsContext(segments, offset, len(batch), segTranslator.ContextWindow())
+		}
+		offset += len(batch)
+		go func(i int, batch, before, after []Segment) {
+			defer wg.Done()
+			results[i] = translateBatch(ctx, batch, before, after, src, dest, translator, stats)
+		}(i, batch, before, after)
+	}
+	wg.Wait()
+
+	var translateds []Segment
+	for _, result := range results {
+		translateds = append(translateds, result...)
+	}
+	return translateds
+}
+
+func segmentsContext(segments []Segment, offset, size, window int) (before, after []Segment) {
+	beforeIdx := offset - window
+	if beforeIdx < 0 {
+		beforeIdx = 0
+	}
+	afterIdx := offset + size + window
+	if afterIdx > len(segments) {
+		afterIdx = len(segments)
+	}
+	return segments[beforeIdx:offset], segments[offset+size : afterIdx]
+}
+
+func translateBatch(ctx context.Context, batch, before, after []Segment, src, dest string, translator Translator, stats *translationStats) []Segment {
+	translated, err := requestSegments(ctx, batch, before, after, src, dest, translator, stats)
+	if err != nil {
+		log.Println(err)
+	}
+	aligned, missing := alignSegments(batch, translated)
+	if len(missing) == 0 {
+		return aligned
+	}
+
+	// a failed request is not retried per segment, only broken alignments
+	retry := len(batch) > 1 && len(translated) > 0 && ctx.Err() == nil
+	if retry {
+		log.Printf("[transub] %d of %d segments did not come back, requesting them one by one", len(missing), len(batch))
+	}
+	texts := map[int]string{}
+	for _, seg := range aligned {
+		texts[seg.ID] = seg.Text
+	}
+	for _, seg := range missing {
+		texts[seg.ID] = seg.Text
+		if retry {
+			result, err := requestSegments(ctx, []Segment{seg}, before, after, src, dest, translator, stats)
+			if err != nil {
+				log.Println(err)
+			}
+			if retried, _ := alignSegments([]Segment{seg}, result); len(retried) == 1 {
+				texts[seg.ID] = retried[0].Text
+				continue
+			}
+		}
+		stats.addFailed(seg.ID)
+	}
+
+	result := make([]Segment, len(batch))
+	for i, seg := range batch {
+		result[i] = Segment{ID: seg.ID, Text: texts[seg.ID]}
+	}
+	return result
+}
+
+// requestSegments sends a batch to the translator. A single segment goes
+// without id to plain text translators, so there is nothing to misalign
+func requestSegments(ctx context.Context, batch, before, after []Segment, src, dest string, translator Translator, stats *translationStats) ([]Segment, error) {
+	if segTranslator, ok := translator.(SegmentTranslator); ok {
+		stats.addSent(sentSegments(batch)...)
+		stats.addSent(sentSegments(before)...)
+		stats.addSent(sentSegments(after)...)
+		return translateSegmentsContext(ctx, segTranslator, batch, before, after, src, dest)
+	}
+	if len(batch) == 1 {
+		stats.addSent(batch[0].Text)
+		text, err := translateContext(ctx, translator, batch[0].Text, src, dest)
+		if err != nil {
+			return nil, err
+		}
+		return []Segment{{ID: batch[0].ID, Text: strings.TrimSpace(text)}}, nil
+	}
+	encoded := encodeSegments(batch)
+	stats.addSent(encoded)
+	text, err := translateContext(ctx, translator, encoded, src, dest)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSegments(text), nil
+}
@@ -0,0 +1,72 @@
+package transub
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mangleTranslator upper cases texts like fakeTranslator, but batches lose
+// the segments listed on drop and get their ids merged on the first line
+type mangleTranslator struct {
+	fakeTranslator
+	mu       sync.Mutex
+	drop     map[string]bool
+	requests []string
+}
+
+func (m *mangleTranslator) Translate(text, src, dest string) (string, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, text)
+	m.mu.Unlock()
+	if !strings.Contains(text, "[[") {
+		return strings.ToUpper(text), nil
+	}
+	var lines []string
+	for _, line := range strings.Split(text, LN_BREAK) {
+		if m.drop[line] {
+			continue
+		}
+		lines = append(lines, strings.ToUpper(strings.Replace(line, "]] ", "]]", 1)))
+	}
+	return strings.Join(lines, LN_BREAK), nil
+}
+
+func TestTranslateSegments(t *testing.T) {
+	segments := []Segment{
+		{ID: 1, Text: "Wait; what?"},
+		{ID: 3, Text: "I said no" + LN_SEP + "never"},
+		{ID: 4, Text: "[[7]] is not an id"},
+		{ID: 9, Text: "bye"},
+	}
+	tr := &mangleTranslator{drop: map[string]bool{"[[9]] bye": true}}
+
+	got := translateSegments(context.Background(), segments, "en", "pt", tr, nil)
+	want := []Segment{
+		{ID: 1, Text: "WAIT; WHAT?"},
+		{ID: 3, Text: "I SAID NO" + LN_SEP + "NEVER"},
+		{ID: 4, Text: "[[7]] IS NOT AN ID"},
+		{ID: 9, Text: "BYE"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if last := tr.requests[len(tr.requests)-1]; last != "bye" {
+		t.Errorf("dropped segment was not requested alone: %q", last)
+	}
+}
+
+func TestAlignSegments(t *testing.T) {
+	batch := []Segment{{ID: 1, Text: "a"}, {ID: 2, Text: "b"}, {ID: 3, Text: "c"}, {ID: 4, Text: "d"}}
+	translated := []Segment{{ID: 4, Text: "D"}, {ID: 2, Text: "B"}, {ID: 2, Text: "B2"}, {ID: 3, Text: ""}, {ID: 8, Text: "X"}}
+
+	aligned, missing := alignSegments(batch, translated)
+	if want := []Segment{{ID: 4, Text: "D"}}; !reflect.DeepEqual(aligned, want) {
+		t.Errorf("aligned: got %+v, want %+v", aligned, want)
+	}
+	if want := batch[:3]; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing: got %+v, want %+v", missing, want)
+	}
+}
@@ -0,0 +1,189 @@
+package transub
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SentenceCfg merges consecutive cues into whole sentences before they are
+// translated, so verb final languages get the full sentence. The
+// translation is then split back across the original cues at word
+// boundaries, proportionally to their text length or duration
+type SentenceCfg struct {
+	// Enabled turns the sentence merging on
+	Enabled bool
+	// ByTiming splits by cue duration instead of source text length
+	ByTiming bool
+	// MaxCues in a sentence. Defaults to 3
+	MaxCues int
+	// MaxGap between two cues of a sentence. Defaults to 1.5s
+	MaxGap time.Duration
+}
+
+const (
+	sentenceMaxCues = 3
+	sentenceMaxGap  = 1500 * time.Millisecond
+)
+
+// sentence is a merged segment and the segments it was made of
+type sentence struct {
+	seg   Segment
+	parts []Segment
+}
+
+func WithSentences(cfg SentenceCfg) func(*Options) {
+	return func(opt *Options) {
+		opt.Sentences = cfg
+	}
+}
+
+// mergeSentences joins the segments of unfinished sentences. Cues with
+// inline markup placeholders, dialogue dashes or multiple lines are never
+// merged, their structure would be lost in the split
+func (doc *Document) mergeSentences(segments []Segment, cfg SentenceCfg) []sentence {
+	maxCues, maxGap := cfg.MaxCues, cfg.MaxGap
+	if maxCues <= 0 {
+		maxCues = sentenceMaxCues
+	}
+	if maxGap <= 0 {
+		maxGap = sentenceMaxGap
+	}
+
+	var sentences []sentence
+	for i := 0; i < len(segments); i++ {
+		sent := sentence{parts: []Segment{segments[i]}}
+		for len(sent.parts) < maxCues && i+1 < len(segments) {
+			last, next := sent.parts[len(sent.parts)-1], segments[i+1]
+			if !doc.continuesSentence(last, next, maxGap) {
+				break
+			}
+			sent.parts = append(sent.parts, next)
+			i++
+		}
+		texts := make([]string, len(sent.parts))
+		for j, part := range sent.parts {
+			texts[j] = part.Text
+		}
+		sent.seg = Segment{ID: sent.parts[0].ID, Text: strings.Join(texts, " ")}
+		sentences = append(sentences, sent)
+	}
+	return sentences
+}
+
+func (doc *Document) continuesSentence(last, next Segment, maxGap time.Duration) bool {
+	if !isMergeableSegment(last) || !isMergeableSegment(next) || endsSentence(last.Text) {
+		return false
+	}
+	lastCue, nextCue := doc.Cues[last.ID], doc.Cues[next.ID]
+	// overlapping cues are on screen together, not one after the other
+	gap := nextCue.Start - lastCue.End
+	return gap >= 0 && gap <= maxGap
+}
+
+func isMergeableSegment(seg Segment) bool {
+	return !strings.Contains(seg.Text, strings.TrimSpace(LN_SEP)) &&
+		!placeholderRe.MatchString(seg.Text) &&
+		!strings.HasPrefix(seg.Text, "-")
+}
+
+// endsSentence checks the last rune, skipping closing quotes and brackets
+func endsSentence(text string) bool {
+	text = strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"'”’»)]`, r)
+	})
+	last, _ := utf8.DecodeLastRuneInString(text)
+	return strings.ContainsRune(".!?…♪:;。！？", last)
+}
+
+// splitSentences spreads each translated sentence back over its cues. A
+// translation with fewer words than cues can not be spread, its parts come
+// back as unsplit to be translated one by one
+func (doc *Document) splitSentences(sentences []sentence, translateds []Segment, cfg SentenceCfg) (segments, unsplit []Segment) {
+	for i, sent := range sentences {
+		if len(sent.parts) == 1 {
+			segments = append(segments, Segment{ID: sent.parts[0].ID, Text: translateds[i].Text})
+			continue
+		}
+		if len(strings.Fields(translateds[i].Text)) < len(sent.parts) {
+			unsplit = append(unsplit, sent.parts...)
+			continue
+		}
+		weights := make([]float64, len(sent.parts))
+		for j, part := range sent.parts {
+			if cfg.ByTiming {
+				cue := doc.Cues[part.ID]
+				weights[j] = float64(cue.End - cue.Start)
+			} else {
+				weights[j] = float64(utf8.RuneCountInString(part.Text))
+			}
+		}
+		for j, text := range splitByWeights(translateds[i].Text, weights) {
+			segments = append(segments, Segment{ID: sent.parts[j].ID, Text: text})
+		}
+	}
+	return segments, unsplit
+}
+
+// splitByWeights cuts text in len(weights) pieces at word boundaries, each
+// one as close as it gets to its share of the text. A boundary after a
+// punctuation mark wins over a slightly closer one. With fewer words than
+// pieces, the first pieces are left empty
+func splitByWeights(text string, weights []float64) []string {
+	words := strings.Fields(text)
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = float64(len(weights))
+	}
+
+	// ends[i] is the rune length of words[:i+1] joined by spaces
+	ends := make([]int, len(words))
+	length := 0
+	for i, word := range words {
+		if i > 0 {
+			length++
+		}
+		length += utf8.RuneCountInString(word)
+		ends[i] = length
+	}
+
+	pieces := make([]string, len(weights))
+	start, share := 0, 0.0
+	for i := range weights[:len(weights)-1] {
+		share += weights[i] / total
+		target := share * float64(length)
+		// leave at least a word for every remaining piece
+		last := len(words) - (len(weights) - i)
+		if start > last {
+			continue
+		}
+		best, bestScore := -1, 0.0
+		for j := start; j <= last; j++ {
+			score := abs(float64(ends[j]) - target)
+			if strings.ContainsAny(words[j][len(words[j])-1:], ",;:.!?") {
+				score -= float64(length) / 10
+			}
+			if best < 0 || score < bestScore {
+				best, bestScore = j, score
+			}
+		}
+		pieces[i] = strings.Join(words[start:best+1], " ")
+		start = best + 1
+	}
+	pieces[len(pieces)-1] = strings.Join(words[start:], " ")
+	return pieces
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,120 @@
+package transub
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDocument_mergeSentences(t *testing.T) {
+	doc, err := ParseDocument(strings.Split(`1
+00:00:01,000 --> 00:00:02,000
+I told you that
+
+2
+00:00:02,100 --> 00:00:03,000
+we would never
+
+3
+00:00:03,100 --> 00:00:04,000
+come back here.
+
+4
+00:00:04,100 --> 00:00:05,000
+Never
+
+5
+00:00:09,000 --> 00:00:10,000
+again.`, "\n"), FormatSRT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := SentenceCfg{Enabled: true}
+	sentences := doc.mergeSentences(doc.translatableSegments(false), cfg)
+	if len(sentences) != 3 || sentences[0].seg.Text != "I told you that we would never come back here." {
+		t.Fatalf("unexpected sentences %+v", sentences)
+	}
+
+	translateds := []Segment{
+		{ID: 0, Text: "Eu te disse que nunca mais voltaríamos aqui."},
+		{ID: 3, Text: "Nunca"},
+		{ID: 4, Text: "mais."},
+	}
+	got, unsplit := doc.splitSentences(sentences, translateds, cfg)
+	if len(unsplit) > 0 {
+		t.Errorf("unexpected unsplit %+v", unsplit)
+	}
+	want := []string{"Eu te disse que", "nunca mais", "voltaríamos aqui.", "Nunca", "mais."}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i, seg := range got {
+		if seg.ID != i || seg.Text != want[i] {
+			t.Errorf("segment %d: got %d %q, want %q", i, seg.ID, seg.Text, want[i])
+		}
+	}
+}
+
+func TestSplitByWeights(t *testing.T) {
+	got := splitByWeights("one two three, four five six seven", []float64{1, 1})
+	if got[0] != "one two three," || got[1] != "four five six seven" {
+		t.Errorf("expected the break after the comma, got %q", got)
+	}
+	got = splitByWeights("only", []float64{1, 1, 1})
+	if got[0] != "" || got[1] != "" || got[2] != "only" {
+		t.Errorf("unexpected split %q", got)
+	}
+	got = splitByWeights("Vamos embora.", []float64{1, 1, 1})
+	if got[0] != "" || got[1] != "Vamos" || got[2] != "embora." {
+		t.Errorf("unexpected split %q", got)
+	}
+}
+
+// shortTranslator translates "Come on, we have to go now." in two words
+// and writes any other text in upper case
+type shortTranslator struct {
+	fakeTranslator
+}
+
+func (s shortTranslator) Translate(text, src, dest string) (string, error) {
+	return strings.ToUpper(strings.Replace(text, "Come on, we have to go now.", "Vamos embora.", 1)), nil
+}
+
+func TestTransub_SentencesFewWords(t *testing.T) {
+	src := `1
+00:00:01,000 --> 00:00:02,000
+Come on,
+
+2
+00:00:02,100 --> 00:00:03,000
+we have to
+
+3
+00:00:03,100 --> 00:00:04,000
+go now.
+`
+	r, res, err := TranslateReader(context.Background(), strings.NewReader(src), FormatSRT, "pt",
+		WithTranslator(shortTranslator{fakeTranslator{lang: "en"}}), WithSentences(SentenceCfg{Enabled: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sentence can not be spread over its cues, they are translated one by one
+	for _, want := range []string{"COME ON,", "WE HAVE TO", "GO NOW."} {
+		if strings.Count(string(out), want) != 1 {
+			t.Errorf("output should have %q once:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "VAMOS") {
+		t.Errorf("output kept the sentence translation:\n%s", out)
+	}
+	if res.Translated != 3 || res.Cached != 0 || res.Failed != 0 {
+		t.Errorf("unexpected counts %+v", res)
+	}
+}
@@ -2,127 +2,153 @@ package transub
 
 import (
 	"fmt"
-	"log"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
-type srtTranslate struct {
-	originals     []string
-	translateds   []string
-	translatables []string
-	transChuncks  []string
-}
+// eg: 00:01:48,083 --> 00:01:50,792
+var srtTimingRe = regexp.MustCompile(`^(\d+:\d{1,2}:\d{1,2}[,.]\d{1,3})\s*-->\s*(\d+:\d{1,2}:\d{1,2}[,.]\d{1,3})(.*)$`)
+
+// eg: <i>, </font>, <font color="#ffff00">, {\an8}
+var srtTagRe = regexp.MustCompile(`</?[a-zA-Z][^>]*>|\{\\[^}]*\}`)
 
-func translasteSRT(ts *Transub) ([]string, error) {
+func parseSRT(lines []string) (*Document, error) {
+	doc := &Document{Format: FormatSRT, Meta: map[string]string{}}
 
-	fileLines, err := ts.getSourceFileLines()
-	if err != nil {
-		return fileLines, err
+	var timingIdxs []int
+	for idx, line := range lines {
+		if srtTimingRe.MatchString(strings.TrimSpace(line)) {
+			timingIdxs = append(timingIdxs, idx)
+		}
+	}
+	if len(timingIdxs) == 0 {
+		return doc, fmt.Errorf("[transub] no srt timestamps found. This might not be an actual .srt file")
 	}
 
-	var srt srtTranslate
-	srt.originals = fileLines
-	srt.extractSpeechLines(opts.RemoveCC)
-	if err = ts.updateSrcLang(srt.transChuncks); err != nil {
-		log.Println(err, "I'll keep using '%s'", opts.LanguageSrc)
+	// the sequence number is the line right before the timestamp
+	hasIndex := func(timingIdx int) bool {
+		return timingIdx > 0 && Validator.isIntStr(strings.TrimSpace(lines[timingIdx-1]))
 	}
-	transSpeeches := translateMany(srt.transChuncks, opts.LanguageSrc, ts.LanguageDest, opts.Retries)
-	srt.mergeTranslatedToOriginal(transSpeeches)
-	return srt.translateds, nil
-}
 
-func (srt *srtTranslate) extractSpeechLines(removeCC bool) {
-	translatableLine := ""
+	headerEnd := timingIdxs[0]
+	if hasIndex(headerEnd) {
+		headerEnd--
+	}
+	doc.Header = trimBlankLines(lines[:headerEnd])
 
-	normalizeLine := func(line string, index, accSize int) string {
-		if Validator.isTranslatable(line, removeCC) {
-			line = strings.ReplaceAll(line, ";", ",")
-			if accSize == 0 {
-				line = fmt.Sprintf("%d;%s", index, line)
+	for n, timingIdx := range timingIdxs {
+		textEnd := len(lines)
+		if n+1 < len(timingIdxs) {
+			textEnd = timingIdxs[n+1]
+			if hasIndex(textEnd) {
+				textEnd--
 			}
-		} else {
-			line = ""
 		}
-		return strings.TrimSpace(line)
-	}
 
-	updateTransChuncks := func(text string) {
-		nextLineLen := len(translatableLine) + len(text)
-		if nextLineLen >= gtransCharLimit {
-			srt.transChuncks = append(srt.transChuncks, translatableLine)
-			translatableLine = ""
+		cue := &Cue{Index: n + 1, Meta: map[string]string{}}
+		if hasIndex(timingIdx) {
+			cue.Index, _ = strconv.Atoi(strings.TrimSpace(lines[timingIdx-1]))
 		}
-		if len(text) > 0 {
-			translatableLine += text + LN_BREAK
+		matches := srtTimingRe.FindStringSubmatch(strings.TrimSpace(lines[timingIdx]))
+		cue.Start, _ = parseSRTTimestamp(matches[1])
+		cue.End, _ = parseSRTTimestamp(matches[2])
+		if settings := strings.TrimSpace(matches[3]); len(settings) > 0 {
+			cue.Meta[metaSettings] = settings
+		}
+
+		for _, line := range lines[timingIdx+1 : textEnd] {
+			if strings.HasPrefix(line, META_TRASNLATED) {
+				continue
+			}
+			cue.Lines = append(cue.Lines, line)
 		}
+		cue.Lines = trimBlankLines(cue.Lines)
+		doc.Cues = append(doc.Cues, cue)
 	}
 
-	var acc []string
-	for idx, line := range srt.originals {
-		if Validator.isIntStr(line) || Validator.isTimestampStr(line) {
-			srt.translatables = append(srt.translatables, "")
-			continue
+	return doc, nil
+}
+
+func (doc *Document) srtLines() []string {
+	var lines []string
+	if len(doc.Header) > 0 {
+		lines = append(lines, doc.Header...)
+		lines = append(lines, "")
+	}
+	for idx, cue := range doc.Cues {
+		index := cue.Index
+		if index <= 0 {
+			index = idx + 1
 		}
-		if Validator.isLineBreak(line) {
-			joined := strings.Join(acc, LN_SEP)
-			srt.translatables = append(srt.translatables, joined)
-			updateTransChuncks(joined)
-			acc = []string{}
-			continue
+		timing := formatSRTTimestamp(cue.Start) + " --> " + formatSRTTimestamp(cue.End)
+		if settings := cue.Meta[metaSettings]; len(settings) > 0 {
+			timing += " " + settings
 		}
+		lines = append(lines, strconv.Itoa(index), timing)
+		lines = append(lines, cue.Lines...)
+		lines = append(lines, "")
+	}
+	return lines
+}
 
-		line = normalizeLine(line, idx, len(acc))
-		if len(line) > 0 {
-			acc = append(acc, line)
-		}
+func parseSRTTimestamp(timestamp string) (time.Duration, error) {
+	timestamp = strings.Replace(strings.TrimSpace(timestamp), ",", ".", 1)
+	return parseClockTimestamp(timestamp)
+}
 
+// formatSRTTimestamp formats as 00:01:48,083
+func formatSRTTimestamp(d time.Duration) string {
+	if d < 0 {
+		d = 0
 	}
-	if len(acc) > 0 {
-		joined := strings.Join(acc, LN_SEP)
-		srt.translatables = append(srt.translatables, joined)
-		updateTransChuncks(joined)
-	}
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	ms := (d % time.Second) / time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", h, m, s, ms)
 }
 
-func (srt *srtTranslate) mergeTranslatedToOriginal(transSpeeches []string) {
-	getLineText := func(translation string) (int, string) {
-		splited := strings.Split(translation, ";")
-		if len(splited) < 1 {
-			return -1, ""
-		}
-		idx, err := strconv.Atoi(strings.TrimSpace(splited[0]))
-		if err != nil {
-			return -1, ""
+// parseClockTimestamp parses h:mm:ss.fff like timestamps, where the
+// fraction can have any number of digits
+func parseClockTimestamp(timestamp string) (time.Duration, error) {
+	invalid := fmt.Errorf("[transub] invalid timestamp '%s'", timestamp)
+	clock, fraction, _ := strings.Cut(timestamp, ".")
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, invalid
+	}
+	var d time.Duration
+	for _, part := range parts {
+		val, err := strconv.Atoi(part)
+		if err != nil || val < 0 {
+			return 0, invalid
 		}
-		txt := strings.TrimSpace(splited[1])
-		return idx, txt
+		d = d*60 + time.Duration(val)
 	}
-
-	srt.translateds = srt.originals
-
-	for _, speechLine := range transSpeeches {
-		subtitles := strings.Split(speechLine, LN_BREAK)
-		if len(subtitles) == 0 {
-			continue
+	d *= time.Second
+	if len(fraction) > 0 {
+		val, err := strconv.Atoi(fraction)
+		if err != nil || val < 0 {
+			return 0, invalid
 		}
-		for _, subtitle := range subtitles {
-			idx, text := getLineText(subtitle)
-			if idx == -1 {
-				continue
-			}
-
-			subTexts := strings.Split(text, LN_SEP)
-			if len(subTexts) == 0 {
-				continue
-			}
-			if len(subTexts) == 1 {
-				srt.translateds[idx] = text
-				continue
-			}
-			for subIdx, subTxt := range subTexts {
-				srt.translateds[idx+subIdx] = subTxt
-			}
+		frac := time.Duration(val) * time.Second
+		for i := 0; i < len(fraction); i++ {
+			frac /= 10
 		}
+		d += frac
+	}
+	return d, nil
+}
+
+func trimBlankLines(lines []string) []string {
+	start, end := 0, len(lines)
+	for start < end && Validator.isLineBreak(strings.TrimSpace(lines[start])) {
+		start++
+	}
+	for end > start && Validator.isLineBreak(strings.TrimSpace(lines[end-1])) {
+		end--
 	}
+	return lines[start:end]
 }
@@ -2,140 +2,193 @@ package transub
 
 import (
 	"fmt"
-	"log"
 	"math"
-	"strconv"
+	"regexp"
 	"strings"
+	"time"
 )
 
-type sliptedDialogue struct {
-	meta string
-	text string
-}
+var (
+	ssaDefaultFields   = []string{"Layer", "Start", "End", "Style", "Name", "MarginL", "MarginR", "MarginV", "Effect", "Text"}
+	ssaV4DefaultFields = []string{"Marked", "Start", "End", "Style", "Name", "MarginL", "MarginR", "MarginV", "Effect", "Text"}
+	// override blocks like {\pos(10,10)} or {\i1}, soft line breaks \n and hard spaces \h
+	ssaTagRe = regexp.MustCompile(`\{[^}]*\}|\\[nh]`)
+)
 
-type ssaDialogues struct {
-	texts    []string
-	spliteds []sliptedDialogue
-}
+// parseSSA reads both SubStation Alpha (v4) and Advanced SubStation (v4+)
+// files. [Script Info] entries goes to doc.Meta (prefixed by "info."),
+// styles to doc.Styles and [Events] to doc.Cues. Everything up to the
+// events Format line is kept as the header.
+func parseSSA(lines []string) (*Document, error) {
+	doc := &Document{Format: FormatSSA, Meta: map[string]string{}, Styles: map[string]map[string]string{}}
+
+	section := ""
+	var styleFields, eventFields []string
+	headerEnd := -1
+	for idx := 0; idx < len(lines); idx++ {
+		line := lines[idx]
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if section == ssaParserEvtsStr && (headerEnd >= 0 || len(doc.Cues) > 0) {
+				doc.Footer = lines[idx:]
+				break
+			}
+			section = strings.ToLower(line)
+			continue
+		}
+		if strings.HasPrefix(line, META_TRASNLATED) {
+			continue
+		}
 
-type ssaTranslate struct {
-	originals     []string
-	translateds   []string
-	dialogues     ssaDialogues
-	fileHeaders   []string
-	translatables []string
-}
+		key, value, found := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch section {
+		case ssaParserInfoStr:
+			if found && !strings.HasPrefix(line, ";") {
+				doc.Meta[ssaInfoPrefix+key] = value
+			}
 
-type formatOK = int
+		case ssaParserStylesStr, ssaParserV4StylesStr:
+			if !found {
+				continue
+			}
+			if strings.EqualFold(key, "Format") {
+				styleFields = splitSSAFields(value, -1)
+			}
+			if strings.EqualFold(key, "Style") && len(styleFields) > 0 {
+				style := map[string]string{}
+				for i, val := range splitSSAFields(value, len(styleFields)) {
+					style[styleFields[i]] = val
+				}
+				doc.Styles[style["Name"]] = style
+			}
 
-func translateSSA(ts *Transub) (translateds []string, err error) {
-	fileLines, err := ts.getSourceFileLines()
-	if err != nil {
-		return translateds, err
+		case ssaParserEvtsStr:
+			if headerEnd < 0 {
+				if found && strings.EqualFold(key, "Format") {
+					eventFields = splitSSAFields(value, -1)
+					headerEnd = idx + 1
+					continue
+				}
+				if !constCompare(line, ssaParserDialogueStr) {
+					continue
+				}
+				// could not find the Format line, try to guess it from the dialogues
+				if guessSSAFormatLen(lines) != len(ssaDefaultFields) {
+					return doc, fmt.Errorf("could find or guess .ssa Dialogue format. This might not be an actual .ssa file")
+				}
+				eventFields = ssaDefaultFields
+				if !strings.HasSuffix(doc.Meta[ssaInfoPrefix+"ScriptType"], "+") {
+					eventFields = ssaV4DefaultFields
+				}
+				headerEnd = idx
+			}
+			if strings.HasPrefix(line, ";") {
+				cue := &Cue{Lines: []string{line}, Meta: map[string]string{metaRaw: "true"}}
+				cue.Meta[metaTranslatable] = "false"
+				doc.Cues = append(doc.Cues, cue)
+				continue
+			}
+			if found {
+				doc.Cues = append(doc.Cues, parseSSAEvent(key, value, eventFields))
+			}
+		}
 	}
-	var ssa ssaTranslate
-	ssa.originals = fileLines
-	ssa.extractDialogues(fileLines, opts.RemoveCC, ssaParserUnknFormat)
 
-	if err = ts.updateSrcLang(ssa.translatables); err != nil {
-		log.Println(err, "I'll keep using '%s'", opts.LanguageSrc)
+	if headerEnd < 0 {
+		return doc, fmt.Errorf("could not find .ssa [Events] section. This might not be an actual .ssa file")
 	}
-	transDialogues := translateMany(ssa.translatables, opts.LanguageSrc, ts.LanguageDest, opts.Retries)
-	ssa.mergeTranslatedToOriginal(transDialogues)
+	doc.Header = lines[:headerEnd]
+	doc.Meta[metaFormat] = strings.Join(eventFields, ",")
 
-	return ssa.translateds, nil
+	return doc, nil
 }
 
-func (ssa *ssaTranslate) extractDialogues(fileAsStrArr []string, removeCC bool, formatLen int) error {
-	formatOK := false
-	translatableLine := ""
-	if formatLen >= 0 {
-		ssa.fileHeaders = []string{}
-		ssa.dialogues = ssaDialogues{}
-		ssa.translatables = []string{}
+// parseSSAEvent parses Dialogue and Comment (or any other event) lines,
+// only Dialogue lines are translated
+func parseSSAEvent(kind, value string, fields []string) *Cue {
+	cue := &Cue{Meta: map[string]string{metaKind: kind}}
+	if kind != ssaDialogueKind {
+		cue.Meta[metaTranslatable] = "false"
+	}
+	for i, val := range splitSSAFields(value, len(fields)) {
+		field := fields[i]
+		switch field {
+		case "Start":
+			cue.Start, _ = parseClockTimestamp(val)
+		case "End":
+			cue.End, _ = parseClockTimestamp(val)
+		case "Text":
+			cue.Lines = strings.Split(val, "\\N")
+		}
+		cue.Meta[field] = val
 	}
+	return cue
+}
 
-	updateTraslatable := func(dialogue sliptedDialogue) {
-		nextLineLen := len(translatableLine) + len(dialogue.text)
-		if nextLineLen >= gtransCharLimit {
-			ssa.translatables = append(ssa.translatables, translatableLine)
-			translatableLine = ""
-		}
-		if len(dialogue.text) > 0 {
-			translatableLine += dialogue.text + LN_BREAK
+// splitSSAFields splits at most n comma separated values. The last field
+// (Text) can have commas on it
+func splitSSAFields(value string, n int) []string {
+	values := strings.SplitN(value, ",", n)
+	for i := range values {
+		if i < len(values)-1 || n < 0 {
+			values[i] = strings.TrimSpace(values[i])
 		}
 	}
+	return values
+}
 
-	for idx, line := range ssa.originals {
-		isDialogue := constCompare(line, ssaParserDialogueStr)
-		if !isDialogue {
-			ssa.appendDialogue("", "")
-			ssa.fileHeaders = append(ssa.fileHeaders, line)
+func (doc *Document) ssaLines() []string {
+	fields := strings.Split(doc.Meta[metaFormat], ",")
+	lines := append([]string{}, doc.Header...)
+	for _, cue := range doc.Cues {
+		if cue.Meta[metaRaw] == "true" {
+			lines = append(lines, cue.Lines...)
 			continue
 		}
-		if formatLen < 0 {
-			formatLen, formatOK = ssa.getFormatLen(idx)
-			if !formatOK {
-				break
+		values := make([]string, len(fields))
+		for i, field := range fields {
+			switch field {
+			case "Start":
+				values[i] = formatSSATimestamp(cue.Start)
+			case "End":
+				values[i] = formatSSATimestamp(cue.End)
+			case "Text":
+				values[i] = strings.Join(cue.Lines, "\\N")
+			default:
+				values[i] = cue.Meta[field]
 			}
 		}
-
-		dialogue := getSliptedDialogue(line, formatLen, idx, removeCC)
-
-		if opts.RemoveCC {
-			dialogue.text = Validator.removeCC(dialogue.text)
-			ssa.originals[idx] = dialogue.meta + "," + dialogue.text
+		kind := cue.Meta[metaKind]
+		if len(kind) == 0 {
+			kind = ssaDialogueKind
 		}
-		ssa.appendDialogue(dialogue.meta, dialogue.text)
-		updateTraslatable(dialogue)
+		lines = append(lines, kind+": "+strings.Join(values, ","))
 	}
-
-	// adds the last translatableLine that for loop could not catch
-	ssa.translatables = append(ssa.translatables, translatableLine)
-
-	// Everything is fine. Just return nil (no errors)
-	if formatOK {
-		return nil
-	}
-
-	// could not guess the ssa format (probably not a ssa file)
-	if formatLen > 0 && !formatOK {
-		return fmt.Errorf("could find or guess .ssa Dialogue format. This might not be an actual .ssa file")
-	} else {
-		// try to guess and returns it self with the best formatLen
-		formatLen = ssa.guessFormatLen()
-		return ssa.extractDialogues(fileAsStrArr, removeCC, formatLen)
+	if len(doc.Footer) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, doc.Footer...)
 	}
+	return lines
 }
 
-func (ssa *ssaTranslate) getFormatLen(idx int) (formatLen int, ok bool) {
-	prevIdx := idx - 1
-	if prevIdx < 0 {
-		return 0, false
-	}
-	// eg: Format: Layer, Start, End, Style, Actor, MarginL, MarginR, MarginV, Effect, Text
-	isFormatLine := constCompare(ssa.originals[prevIdx], ssaParserFormatStr)
-	if !isFormatLine {
-		return 0, false
-	}
-
-	formats := strings.Split(ssa.originals[prevIdx], ",")
-	formatLen = len(formats)
-	if formatLen == 0 {
-		return 0, false
+// formatSSATimestamp formats as 0:00:01.50
+func formatSSATimestamp(d time.Duration) string {
+	if d < 0 {
+		d = 0
 	}
-
-	return formatLen, true
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	cs := (d % time.Second) / (10 * time.Millisecond)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", h, m, s, cs)
 }
 
-func (ssa *ssaTranslate) guessFormatLen() int {
-	if len(ssa.originals) == 0 {
-		return 0
-	}
+func guessSSAFormatLen(lines []string) int {
 	bestGuess := math.MaxInt
-	for _, line := range ssa.originals {
-		isDialogue := constCompare(line, ssaParserDialogueStr)
-		if !isDialogue {
+	for _, line := range lines {
+		if !constCompare(line, ssaParserDialogueStr) {
 			continue
 		}
 		splitedLen := len(strings.Split(line, ","))
@@ -146,73 +199,7 @@ func (ssa *ssaTranslate) guessFormatLen() int {
 	return bestGuess
 }
 
-func (ssa *ssaTranslate) appendDialogue(meta, text string) {
-	ssa.dialogues.texts = append(ssa.dialogues.texts, text)
-	ssa.dialogues.spliteds = append(ssa.dialogues.spliteds, sliptedDialogue{meta, text})
-}
-
-func getSliptedDialogue(line string, formatLen, lnIdx int, removeCC bool) sliptedDialogue {
-	// Splits a dialogue line by commas
-	splited := strings.Split(line, ",")
-	if len(splited) < formatLen {
-		return sliptedDialogue{meta: line, text: ""}
-	}
-	dialogueMeta := strings.Join(splited[:formatLen-1], ",")
-	line = strings.Join(splited[formatLen-1:], ",")
-	line = normalizeSpeechLine(line, lnIdx, removeCC)
-	return sliptedDialogue{meta: dialogueMeta, text: line}
-}
-
-func normalizeSpeechLine(line string, index int, removeCC bool) string {
-	if Validator.isMusic(line) {
-		return line
-	}
-	if Validator.isTranslatable(line, removeCC) {
-		line = strings.ReplaceAll(line, "\\N", LN_SEP)
-		line = strings.ReplaceAll(line, ";", ",")
-		line = fmt.Sprintf("%d;%s", index, line)
-	} else {
-		line = ""
-	}
-	return strings.TrimSpace(line)
-}
-
 func constCompare(text, constStr string) bool {
 	text = strings.TrimSpace(strings.ToLower(text))
 	return strings.HasPrefix(text, constStr)
 }
-
-func (ssa *ssaTranslate) mergeTranslatedToOriginal(transDialogues []string) {
-
-	getLineText := func(translation string) (int, string) {
-		splited := strings.Split(translation, ";")
-		if len(splited) < 1 {
-			return -1, ""
-		}
-		idx, err := strconv.Atoi(strings.TrimSpace(splited[0]))
-		if err != nil {
-			return -1, ""
-		}
-		txt := strings.TrimSpace(splited[1])
-		return idx, txt
-	}
-
-	ssa.translateds = ssa.originals
-
-	for _, dialogueLine := range transDialogues {
-		dialogues := strings.Split(dialogueLine, LN_BREAK)
-		if len(dialogues) == 0 {
-			continue
-		}
-		for _, dialogue := range dialogues {
-			idx, text := getLineText(dialogue)
-			if idx == -1 {
-				continue
-			}
-
-			transText := strings.ReplaceAll(text, LN_SEP, "\\N")
-			dialogueMeta := ssa.dialogues.spliteds[idx].meta + ","
-			ssa.translateds[idx] = dialogueMeta + transText
-		}
-	}
-}
@@ -0,0 +1,62 @@
+package transub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	gtrans "github.com/lcapuano-app/go-googletrans"
+)
+
+// TranslateReader translates the format subtitle read from r to dest and
+// returns it encoded as the output options say. It has no file side
+// effects: no output file, no source mark, no project glossary lookup and
+// options like WithOutputDir or WithMainSub are ignored. Only a Memory
+// given WithMemory is saved to its file. The Result has no output files
+func TranslateReader(ctx context.Context, r io.Reader, format Format, dest string, options ...withOptions) (io.Reader, *Result, error) {
+	start := time.Now()
+	if extFormat, ok := FormatFromExt(string(format)); ok {
+		format = extFormat
+	}
+	if _, ok := FormatFromExt(FormatExt(format)); !ok {
+		return nil, nil, fmt.Errorf("%w: unsupported format '%s'", ErrNotSubtitle, format)
+	}
+	lang, err := gtrans.GetValidLanguageKey(dest)
+	if err != nil || lang == "auto" {
+		return nil, nil, fmt.Errorf("[transub] invalid dest language: %s", dest)
+	}
+
+	ts := NewMultiLang("", []string{lang}, options...)
+	ts.FileExt = FormatExt(format)
+	ts.setLanguage(0)
+	res := &Result{Backend: ts.backend}
+	defer func() {
+		res.Duration = time.Since(start)
+	}()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, res, err
+	}
+	doc, err := ts.parseData(data, format)
+	if err != nil {
+		return nil, res, err
+	}
+	if err = ts.detectSource(ctx, doc, res); err != nil {
+		return nil, res, err
+	}
+	if lang == ts.opts.LanguageSrc {
+		return nil, res, fmt.Errorf("[transub] subtitle is already in '%s'", lang)
+	}
+	translated, langRes, err := ts.translateDocument(ctx, doc, lang)
+	res.add(langRes)
+	if err != nil {
+		return nil, res, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, res, err
+	}
+	return bytes.NewReader(ts.encodeOutput(translated.Lines(), res)), res, nil
+}
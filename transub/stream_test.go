@@ -0,0 +1,60 @@
+package transub
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranslateReader(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("examples", "subtitle.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	r, _, err := TranslateReader(context.Background(), bytes.NewReader(data), FormatSRT, "pt",
+		WithTranslator(fakeTranslator{lang: "en"}),
+		WithOutputFormat(FormatVTT),
+		WithMainSub(true),
+		WithRemoveOrigin(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"WEBVTT", "- HELLO WORLD!", "00:01:48.083 --> 00:01:50.792", META_TRASNLATED + ";pt"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("TranslateReader wrote %d files", len(entries))
+	}
+
+	if _, _, err = TranslateReader(context.Background(), bytes.NewReader(out), FormatVTT, "es",
+		WithTranslator(fakeTranslator{lang: "pt"}),
+	); err == nil {
+		t.Error("expected an already translated error")
+	}
+	if _, _, err = TranslateReader(context.Background(), bytes.NewReader(data), FormatSRT, "en",
+		WithTranslator(fakeTranslator{lang: "en"}),
+	); err == nil {
+		t.Error("expected an error translating to the source language")
+	}
+}
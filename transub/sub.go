@@ -0,0 +1,164 @@
+package transub
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	microDVDDefaultFPS = 23.976
+	// used when a MicroDVD cue has no end frame, eg: {100}{}text
+	microDVDDefaultDuration = 2 * time.Second
+)
+
+var (
+	// eg: {100}{200}Hello|{y:i}world
+	microDVDLineRe = regexp.MustCompile(`^\{(\d+)\}\{(\d*)\}(.*)$`)
+	// style codes like {y:i}, {Y:b}, {c:$0000FF} or {f:Arial}
+	microDVDTagRe = regexp.MustCompile(`\{[a-zA-Z]:[^}]*\}`)
+	// eg: 00:00:41.00,00:00:44.40
+	subViewerTimingRe = regexp.MustCompile(`^(\d+:\d{2}:\d{2}\.\d{1,3}),(\d+:\d{2}:\d{2}\.\d{1,3})$`)
+)
+
+// detectSubFormat tells MicroDVD and SubViewer apart, as both uses .sub
+func detectSubFormat(lines []string) Format {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.EqualFold(line, subViewerInfoStr) || subViewerTimingRe.MatchString(line) {
+			return FormatSubViewer
+		}
+		if microDVDLineRe.MatchString(line) {
+			return FormatMicroDVD
+		}
+	}
+	return FormatMicroDVD
+}
+
+// parseMicroDVD reads frame based subtitles. The frame rate comes from the
+// optional {1}{1}23.976 header, otherwise microDVDDefaultFPS is used until
+// SetFrameRate is called
+func parseMicroDVD(lines []string) (*Document, error) {
+	doc := &Document{Format: FormatMicroDVD, Meta: map[string]string{}}
+	fps := microDVDDefaultFPS
+
+	for _, line := range lines {
+		matches := microDVDLineRe.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+		if len(doc.Cues) == 0 && matches[1] == "1" && matches[2] == "1" {
+			if headerFPS, err := strconv.ParseFloat(strings.TrimSpace(matches[3]), 64); err == nil && headerFPS > 0 {
+				fps = headerFPS
+				doc.Meta[metaFPSHeader] = "true"
+				continue
+			}
+		}
+		cue := &Cue{
+			Index: len(doc.Cues) + 1,
+			Lines: strings.Split(matches[3], "|"),
+			Meta:  map[string]string{metaStartFrame: matches[1], metaEndFrame: matches[2]},
+		}
+		doc.Cues = append(doc.Cues, cue)
+	}
+	if len(doc.Cues) == 0 {
+		return doc, fmt.Errorf("[transub] no {start}{end} frames found. This might not be an actual MicroDVD file")
+	}
+
+	doc.SetFrameRate(fps)
+	return doc, nil
+}
+
+// SetFrameRate recomputes frame based cues timings. It has no effect on
+// formats that are not frame based
+func (doc *Document) SetFrameRate(fps float64) {
+	if doc.Format != FormatMicroDVD || fps <= 0 {
+		return
+	}
+	doc.Meta[metaFPS] = strconv.FormatFloat(fps, 'f', -1, 64)
+	for _, cue := range doc.Cues {
+		start, _ := strconv.Atoi(cue.Meta[metaStartFrame])
+		cue.Start = framesToDuration(start, fps)
+		end, err := strconv.Atoi(cue.Meta[metaEndFrame])
+		if err != nil {
+			// empty end frame, keeps it on screen for a while
+			cue.End = cue.Start + microDVDDefaultDuration
+			continue
+		}
+		cue.End = framesToDuration(end, fps)
+	}
+}
+
+func (doc *Document) microDVDLines() []string {
+	fps, err := strconv.ParseFloat(doc.Meta[metaFPS], 64)
+	if err != nil || fps <= 0 {
+		fps = microDVDDefaultFPS
+	}
+	var lines []string
+	if doc.Meta[metaFPSHeader] == "true" {
+		lines = append(lines, fmt.Sprintf("{1}{1}%s", strconv.FormatFloat(fps, 'f', -1, 64)))
+	}
+	for _, cue := range doc.Cues {
+		start := durationToFrames(cue.Start, fps)
+		end := strconv.Itoa(durationToFrames(cue.End, fps))
+		if endFrame, ok := cue.Meta[metaEndFrame]; ok && len(endFrame) == 0 && cue.End == cue.Start+microDVDDefaultDuration {
+			end = ""
+		}
+		lines = append(lines, fmt.Sprintf("{%d}{%s}%s", start, end, strings.Join(cue.Lines, "|")))
+	}
+	return lines
+}
+
+func framesToDuration(frames int, fps float64) time.Duration {
+	return time.Duration(math.Round(float64(frames) / fps * float64(time.Second)))
+}
+
+func durationToFrames(d time.Duration, fps float64) int {
+	return int(math.Round(d.Seconds() * fps))
+}
+
+// parseSubViewer reads SubViewer 2.0 files, where [br] breaks the lines
+func parseSubViewer(lines []string) (*Document, error) {
+	doc := &Document{Format: FormatSubViewer, Meta: map[string]string{}}
+
+	var cue *Cue
+	for idx, line := range lines {
+		line = strings.TrimSpace(line)
+		if matches := subViewerTimingRe.FindStringSubmatch(line); matches != nil {
+			if len(doc.Cues) == 0 {
+				doc.Header = trimBlankLines(lines[:idx])
+			}
+			cue = &Cue{Index: len(doc.Cues) + 1, Meta: map[string]string{}}
+			cue.Start, _ = parseClockTimestamp(matches[1])
+			cue.End, _ = parseClockTimestamp(matches[2])
+			doc.Cues = append(doc.Cues, cue)
+			continue
+		}
+		if cue == nil || len(line) == 0 || strings.HasPrefix(line, META_TRASNLATED) {
+			continue
+		}
+		cue.Lines = append(cue.Lines, strings.Split(line, subViewerBreak)...)
+	}
+	if len(doc.Cues) == 0 {
+		return doc, fmt.Errorf("[transub] no timestamps found. This might not be an actual SubViewer file")
+	}
+
+	return doc, nil
+}
+
+func (doc *Document) subViewerLines() []string {
+	lines := append([]string{}, doc.Header...)
+	for _, cue := range doc.Cues {
+		timing := formatSubViewerTimestamp(cue.Start) + "," + formatSubViewerTimestamp(cue.End)
+		lines = append(lines, timing, strings.Join(cue.Lines, subViewerBreak), "")
+	}
+	return lines
+}
+
+// formatSubViewerTimestamp formats as 00:00:41.00
+func formatSubViewerTimestamp(d time.Duration) string {
+	return "0" + formatSSATimestamp(d)
+}
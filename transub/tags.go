@@ -0,0 +1,181 @@
+package transub
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lineTags keeps the markup taken out of a cue line while it is translated.
+// Leading and trailing tags are re-attached as they are, inner ones are
+// swapped by "{n}" placeholders
+type lineTags struct {
+	prefix string
+	suffix string
+	inner  []string
+}
+
+// What to do with a tag which placeholder did not come back
+const (
+	tagOpen      = iota // re-attached at the start of its line text
+	tagClose            // re-attached at the end of its line text
+	tagLineStart        // positioning, goes before everything else
+	tagDrop             // line breaks, hard spaces, entities, timestamps
+)
+
+var (
+	// engines like to add spaces inside the braces: "{ 0 }"
+	placeholderRe = regexp.MustCompile(`\{\s*(\d+)\s*\}`)
+	// eg: {\an8}, {\a6}, {\pos(320,50)}, {\move(0,0,10,10)}
+	ssaPositionalRe     = regexp.MustCompile(`\\(an?\d|pos\(|move\(|org\()`)
+	ssaPositionalOnlyRe = regexp.MustCompile(`^\{(\\(an?\d+|(pos|move|org)\([^)]*\)))+\}$`)
+	// eg: {\i0}, {\b0\u0}, {\r}, {\rAltStyle}
+	ssaOffRe = regexp.MustCompile(`^\{(\\[ibus]0|\\r[^\\}]*)+\}$`)
+)
+
+func tagKind(tag string) int {
+	switch {
+	case tag == `\n` || tag == `\h` || strings.HasPrefix(tag, "&") || strings.HasSuffix(tag, "/>"):
+		return tagDrop
+	case strings.HasPrefix(tag, "</"):
+		return tagClose
+	case len(tag) > 1 && tag[0] == '<' && tag[1] >= '0' && tag[1] <= '9':
+		return tagDrop
+	case strings.HasPrefix(tag, `{\`):
+		if ssaPositionalRe.MatchString(tag) {
+			return tagLineStart
+		}
+		if ssaOffRe.MatchString(tag) {
+			return tagClose
+		}
+		return tagOpen
+	case strings.HasPrefix(tag, "{"):
+		// MicroDVD {y:i}, {c:$0000FF}... style the whole line
+		return tagLineStart
+	}
+	return tagOpen
+}
+
+// protectTags takes out every markup matched by tagRe from the cue lines.
+// Positioning blocks are moved to the start of the line, as players read
+// them from anywhere in it
+func (cue *Cue) protectTags(tagRe *regexp.Regexp) {
+	cue.tags = make([]lineTags, len(cue.Lines))
+	placeholderIdx := 0
+	for i, line := range cue.Lines {
+		var tags lineTags
+		locs := tagRe.FindAllStringIndex(line, -1)
+		if len(locs) == 0 {
+			continue
+		}
+
+		start, end := 0, len(line)
+		for _, loc := range locs {
+			if loc[0] != start {
+				break
+			}
+			start = loc[1]
+		}
+		for i := len(locs) - 1; i >= 0 && locs[i][0] >= start; i-- {
+			if locs[i][1] != end {
+				break
+			}
+			end = locs[i][0]
+		}
+		tags.prefix, tags.suffix = line[:start], line[end:]
+
+		body := tagRe.ReplaceAllStringFunc(line[start:end], func(tag string) string {
+			if ssaPositionalOnlyRe.MatchString(tag) {
+				tags.prefix += tag
+				return ""
+			}
+			tags.inner = append(tags.inner, tag)
+			placeholder := fmt.Sprintf("{%d}", placeholderIdx)
+			placeholderIdx++
+			return placeholder
+		})
+		cue.tags[i] = tags
+		cue.Lines[i] = strings.TrimSpace(body)
+	}
+}
+
+// restoreTags puts back the markup taken out by protectTags. When the
+// translation changed the number of lines, the first line prefix and the
+// last line suffix wraps the whole cue. Tags which placeholders got lost
+// are re-attached around their line text, see tagKind
+func (cue *Cue) restoreTags() {
+	if len(cue.tags) == 0 {
+		return
+	}
+	type innerTag struct {
+		tag  string
+		line int
+	}
+	var inner []innerTag
+	for line, tags := range cue.tags {
+		for _, tag := range tags.inner {
+			inner = append(inner, innerTag{tag, line})
+		}
+	}
+
+	sameLines := len(cue.Lines) == len(cue.tags)
+	restored := make([]bool, len(inner))
+	for i, line := range cue.Lines {
+		cue.Lines[i] = placeholderRe.ReplaceAllStringFunc(line, func(placeholder string) string {
+			idx, _ := strconv.Atoi(placeholderRe.FindStringSubmatch(placeholder)[1])
+			if idx >= len(inner) {
+				return placeholder
+			}
+			if restored[idx] {
+				return ""
+			}
+			restored[idx] = true
+			return inner[idx].tag
+		})
+	}
+
+	heads := make([]string, len(cue.Lines))
+	tails := make([]string, len(cue.Lines))
+	starts := make([]string, len(cue.Lines))
+	for idx, tag := range inner {
+		if restored[idx] {
+			continue
+		}
+		kind := tagKind(tag.tag)
+		line := tag.line
+		if !sameLines {
+			line = 0
+			if kind == tagClose {
+				line = len(cue.Lines) - 1
+			}
+		}
+		if line < 0 || line >= len(cue.Lines) {
+			continue
+		}
+		switch kind {
+		case tagLineStart:
+			starts[line] += tag.tag
+		case tagOpen:
+			heads[line] += tag.tag
+		case tagClose:
+			tails[line] += tag.tag
+		}
+	}
+
+	for i, line := range cue.Lines {
+		prefix, suffix := "", ""
+		if sameLines {
+			prefix, suffix = cue.tags[i].prefix, cue.tags[i].suffix
+		} else {
+			if i == 0 {
+				prefix = cue.tags[0].prefix
+			}
+			if i == len(cue.Lines)-1 {
+				suffix = cue.tags[len(cue.tags)-1].suffix
+			}
+		}
+		cue.Lines[i] = starts[i] + prefix + heads[i] + strings.TrimSpace(line) + tails[i] + suffix
+	}
+	cue.tags = nil
+}
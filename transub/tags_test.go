@@ -0,0 +1,77 @@
+package transub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCue_protectTags(t *testing.T) {
+	cue := &Cue{Lines: []string{`{\an8}<i>Wait!</i>`, `Tell <b>him</b> {\an8}now`}}
+	cue.protectTags(srtTagRe)
+
+	if want := []string{"Wait!", "Tell {0}him{1} now"}; !reflect.DeepEqual(cue.Lines, want) {
+		t.Errorf("got %q, want %q", cue.Lines, want)
+	}
+	if cue.tags[1].prefix != `{\an8}` {
+		t.Errorf("positional tag was not moved to the line start: %q", cue.tags[1].prefix)
+	}
+}
+
+func TestCue_restoreTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		tagRe       string
+		translation []string
+		want        []string
+	}{
+		{
+			name:        "placeholders kept",
+			lines:       []string{`<i>Hello</i> <b>world</b>!`},
+			tagRe:       "srt",
+			translation: []string{"Olá{0} {1}mundo{2}!"},
+			want:        []string{`<i>Olá</i> <b>mundo</b>!`},
+		},
+		{
+			name:        "placeholders with spaces",
+			lines:       []string{`Hello <b>world</b>!`},
+			tagRe:       "srt",
+			translation: []string{"Olá { 0 }mundo{ 1 }!"},
+			want:        []string{`Olá <b>mundo</b>!`},
+		},
+		{
+			name:        "lost placeholders",
+			lines:       []string{`Hello <b>world</b>, {\pos(10,10)}bye`},
+			tagRe:       "srt",
+			translation: []string{"Olá mundo, tchau"},
+			want:        []string{`{\pos(10,10)}<b>Olá mundo, tchau</b>`},
+		},
+		{
+			name:        "duplicated placeholder",
+			lines:       []string{`Hello <b>world</b>`},
+			tagRe:       "srt",
+			translation: []string{"{0}Olá {0}mundo"},
+			want:        []string{`<b>Olá mundo</b>`},
+		},
+		{
+			name:        "ass off block lost on merged lines",
+			lines:       []string{`I {\i1}never`, `said that{\i0} to him`},
+			tagRe:       "ssa",
+			translation: []string{"Eu nunca disse isso a ele"},
+			want:        []string{`{\i1}Eu nunca disse isso a ele{\i0}`},
+		},
+	}
+	for _, tt := range tests {
+		tagRe := srtTagRe
+		if tt.tagRe == "ssa" {
+			tagRe = ssaTagRe
+		}
+		cue := &Cue{Lines: append([]string{}, tt.lines...)}
+		cue.protectTags(tagRe)
+		cue.Lines = append([]string{}, tt.translation...)
+		cue.restoreTags()
+		if !reflect.DeepEqual(cue.Lines, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, cue.Lines, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package transub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Anchor maps a time on the subtitle to the time it should be shown at
+type Anchor struct {
+	From time.Duration
+	To   time.Duration
+}
+
+// TimingCfg fixes out of sync subtitles. The frame rate conversion goes
+// first, then the stretch and the shift last
+type TimingCfg struct {
+	// Shift moves every cue, negative values make them show earlier
+	Shift time.Duration
+	// Stretch maps linearly the first anchor to the second one, both are
+	// needed. Cues before or after the anchors follow the same line
+	Stretch []Anchor
+	// FromFPS and ToFPS convert between frame rates, eg: 23.976 to 25
+	FromFPS float64
+	ToFPS   float64
+}
+
+func WithTiming(cfg TimingCfg) func(*Options) {
+	return func(opt *Options) {
+		opt.Timing = cfg
+	}
+}
+
+func (cfg TimingCfg) isZero() bool {
+	return cfg.Shift == 0 && len(cfg.Stretch) == 0 && cfg.FromFPS == 0 && cfg.ToFPS == 0
+}
+
+// ApplyTiming runs every TimingCfg operation on the document cues
+func (doc *Document) ApplyTiming(cfg TimingCfg) error {
+	if cfg.FromFPS != 0 || cfg.ToFPS != 0 {
+		if err := doc.ConvertFrameRate(cfg.FromFPS, cfg.ToFPS); err != nil {
+			return err
+		}
+	}
+	if len(cfg.Stretch) > 0 {
+		if len(cfg.Stretch) != 2 {
+			return fmt.Errorf("[transub] stretch needs 2 anchors, got %d", len(cfg.Stretch))
+		}
+		if err := doc.Stretch(cfg.Stretch[0], cfg.Stretch[1]); err != nil {
+			return err
+		}
+	}
+	if cfg.Shift != 0 {
+		doc.Shift(cfg.Shift)
+	}
+	return nil
+}
+
+// Shift moves every cue by offset. Cues moved before zero are clamped
+func (doc *Document) Shift(offset time.Duration) {
+	doc.retime(func(d time.Duration) time.Duration {
+		return d + offset
+	})
+}
+
+// Stretch retimes the cues so a is shown at a.To and b at b.To, the ones
+// in between being linearly spread
+func (doc *Document) Stretch(a, b Anchor) error {
+	if a.From == b.From {
+		return fmt.Errorf("[transub] stretch anchors must be at different times")
+	}
+	scale := float64(b.To-a.To) / float64(b.From-a.From)
+	if scale <= 0 {
+		return fmt.Errorf("[transub] stretch anchors would reverse the cues order")
+	}
+	doc.retime(func(d time.Duration) time.Duration {
+		return a.To + time.Duration(float64(d-a.From)*scale)
+	})
+	return nil
+}
+
+// ConvertFrameRate fixes a subtitle timed for a from fps release to be
+// used on a to fps one, eg: 23.976 to 25 on PAL releases
+func (doc *Document) ConvertFrameRate(from, to float64) error {
+	if from <= 0 || to <= 0 {
+		return fmt.Errorf("[transub] invalid frame rate conversion %v to %v", from, to)
+	}
+	scale := from / to
+	doc.retime(func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * scale)
+	})
+	return nil
+}
+
+// retime keeps the times rounded to the millisecond, the precision most
+// formats have
+func (doc *Document) retime(fn func(time.Duration) time.Duration) {
+	for _, cue := range doc.Cues {
+		if cue.Meta[metaRaw] == "true" {
+			continue
+		}
+		cue.Start = clampTime(fn(cue.Start).Round(time.Millisecond))
+		cue.End = clampTime(fn(cue.End).Round(time.Millisecond))
+	}
+}
+
+func clampTime(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// ParseTimestamp reads "01:02:03,500", "-00:00:02.5", "1.5s", "-200ms" or
+// plain seconds like "2.5"
+func ParseTimestamp(timestamp string) (time.Duration, error) {
+	timestamp = strings.TrimSpace(timestamp)
+	sign := time.Duration(1)
+	if strings.HasPrefix(timestamp, "-") {
+		sign = -1
+		timestamp = timestamp[1:]
+	} else {
+		timestamp = strings.TrimPrefix(timestamp, "+")
+	}
+	if strings.Contains(timestamp, ":") {
+		d, err := parseSRTTimestamp(timestamp)
+		return sign * d, err
+	}
+	if seconds, err := strconv.ParseFloat(timestamp, 64); err == nil {
+		return sign * time.Duration(seconds*float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(timestamp)
+	if err != nil {
+		return 0, fmt.Errorf("[transub] invalid timestamp '%s'", timestamp)
+	}
+	return sign * d, nil
+}
+
+// ParseTimingCfg reads the timing options as written on the command line:
+// shift "-1.5s", stretch "00:01:00,000=00:01:02,000;01:30:00,000=01:31:10,000"
+// and fps "23.976:25". Empty values are left off
+func ParseTimingCfg(shift, stretch, fps string) (TimingCfg, error) {
+	var cfg TimingCfg
+	var err error
+	if len(strings.TrimSpace(shift)) > 0 {
+		if cfg.Shift, err = ParseTimestamp(shift); err != nil {
+			return cfg, err
+		}
+	}
+
+	if len(strings.TrimSpace(stretch)) > 0 {
+		for _, anchorStr := range strings.Split(stretch, ";") {
+			fromStr, toStr, ok := strings.Cut(anchorStr, "=")
+			if !ok {
+				return cfg, fmt.Errorf("[transub] invalid stretch anchor '%s', eg: 00:01:00,000=00:01:02,000", anchorStr)
+			}
+			var anchor Anchor
+			if anchor.From, err = ParseTimestamp(fromStr); err != nil {
+				return cfg, err
+			}
+			if anchor.To, err = ParseTimestamp(toStr); err != nil {
+				return cfg, err
+			}
+			cfg.Stretch = append(cfg.Stretch, anchor)
+		}
+		if len(cfg.Stretch) != 2 {
+			return cfg, fmt.Errorf("[transub] stretch needs 2 anchors, got %d", len(cfg.Stretch))
+		}
+	}
+
+	if len(strings.TrimSpace(fps)) > 0 {
+		fromStr, toStr, ok := strings.Cut(fps, ":")
+		if !ok {
+			return cfg, fmt.Errorf("[transub] invalid frame rate conversion '%s', eg: 23.976:25", fps)
+		}
+		if cfg.FromFPS, err = strconv.ParseFloat(strings.TrimSpace(fromStr), 64); err != nil {
+			return cfg, fmt.Errorf("[transub] invalid frame rate '%s'", fromStr)
+		}
+		if cfg.ToFPS, err = strconv.ParseFloat(strings.TrimSpace(toStr), 64); err != nil {
+			return cfg, fmt.Errorf("[transub] invalid frame rate '%s'", toStr)
+		}
+	}
+	return cfg, nil
+}
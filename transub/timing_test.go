@@ -0,0 +1,69 @@
+package transub
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDocument_ApplyTiming(t *testing.T) {
+	lines := strings.Split(`1
+00:01:00,000 --> 00:01:02,000
+Hello
+
+2
+00:02:00,000 --> 00:02:02,500
+World`, "\n")
+
+	tests := []struct {
+		name string
+		cfg  TimingCfg
+		want []string
+	}{
+		{"shift", TimingCfg{Shift: -1500 * time.Millisecond}, []string{
+			"00:00:58,500 --> 00:01:00,500", "00:01:58,500 --> 00:02:01,000",
+		}},
+		{"stretch", TimingCfg{Stretch: []Anchor{
+			{From: time.Minute, To: time.Minute + time.Second},
+			{From: 2 * time.Minute, To: 2*time.Minute + 3*time.Second},
+		}}, []string{
+			"00:01:01,000 --> 00:01:03,067", "00:02:03,000 --> 00:02:05,583",
+		}},
+		{"fps", TimingCfg{FromFPS: 25, ToFPS: 23.976}, []string{
+			"00:01:02,563 --> 00:01:04,648", "00:02:05,125 --> 00:02:07,732",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseDocument(lines, FormatSRT)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = doc.ApplyTiming(tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+			out := strings.Join(doc.Lines(), "\n")
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTimingCfg(t *testing.T) {
+	cfg, err := ParseTimingCfg("-00:00:01,500", "00:01:00,000=00:01:01,000;2m=2m3s", "23.976:25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Shift != -1500*time.Millisecond || len(cfg.Stretch) != 2 || cfg.Stretch[1].To != 123*time.Second {
+		t.Errorf("unexpected cfg %+v", cfg)
+	}
+	if cfg.FromFPS != 23.976 || cfg.ToFPS != 25 {
+		t.Errorf("unexpected frame rates %+v", cfg)
+	}
+	if _, err = ParseTimingCfg("", "00:01:00,000=00:01:01,000", ""); err == nil {
+		t.Error("a single stretch anchor should fail")
+	}
+}
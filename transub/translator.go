@@ -0,0 +1,166 @@
+package transub
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// Translator is the engine used to translate and detect the language of
+// subtitle texts. The default one is backed by go-googletrans, any other
+// engine can be plugged in with WithTranslator.
+type Translator interface {
+	Translate(text, src, dest string) (string, error)
+	DetectLanguage(text string) (lang string, confidence float64, err error)
+}
+
+// charLimiter is implemented by translators that accept requests bigger
+// (or smaller) than Google's gtransCharLimit
+type charLimiter interface {
+	CharLimit() int
+}
+
+// Segment is a single translatable text, identified by its cue position on the document
+type Segment struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+// SegmentTranslator is implemented by translators that benefits from
+// neighbouring cues as context (eg: LLMs). Each batch is sent along with
+// up to ContextWindow previous and next segments. TranslateSegments
+// returns only the segments it could translate, the missing ones are
+// requested again one by one
+type SegmentTranslator interface {
+	Translator
+	ContextWindow() int
+	TranslateSegments(batch, before, after []Segment, src, dest string) ([]Segment, error)
+}
+
+// ContextTranslator is implemented by translators which requests can be
+// cancelled. Any other translator gets its result dropped when the context
+// is done, its request finishes on the background
+type ContextTranslator interface {
+	Translator
+	TranslateContext(ctx context.Context, text, src, dest string) (string, error)
+	DetectLanguageContext(ctx context.Context, text string) (lang string, confidence float64, err error)
+}
+
+// ContextSegmentTranslator is the cancellable SegmentTranslator
+type ContextSegmentTranslator interface {
+	SegmentTranslator
+	TranslateSegmentsContext(ctx context.Context, batch, before, after []Segment, src, dest string) ([]Segment, error)
+}
+
+func WithTranslator(translator Translator) func(*Options) {
+	return func(opt *Options) {
+		opt.Translator = translator
+	}
+}
+
+func WithBackend(backend string) func(*Options) {
+	return func(opt *Options) {
+		opt.Backend = strings.ToLower(strings.TrimSpace(backend))
+	}
+}
+
+func newBackendTranslator(opt Options) Translator {
+	switch opt.Backend {
+	case BackendLibreTranslate:
+		return NewLibreTranslator(opt.LibreTranslate)
+	case BackendDeepL:
+		return NewDeepLTranslator(opt.DeepL)
+	case BackendLLM, "openai", "ollama":
+		return NewLLMTranslator(opt.LLM)
+	case BackendGoogle, "":
+		return NewGoogleTranslator(opt.GTrans, opt.Retries)
+	default:
+		log.Printf("unknown backend '%s', using '%s'", opt.Backend, BackendGoogle)
+		return NewGoogleTranslator(opt.GTrans, opt.Retries)
+	}
+}
+
+// backendName is the backend translations are remembered by on the
+// translation memory. Translators set by WithTranslator are "custom"
+// unless a backend name is also given
+func backendName(backend string, isCustom bool) string {
+	switch backend {
+	case BackendLibreTranslate, BackendDeepL, BackendLLM:
+		return backend
+	case "openai", "ollama":
+		return BackendLLM
+	case "":
+		if isCustom {
+			return BackendCustom
+		}
+		return BackendGoogle
+	}
+	if isCustom {
+		return backend
+	}
+	return BackendGoogle
+}
+
+func translationCharLimit(translator Translator) int {
+	if limiter, ok := translator.(charLimiter); ok {
+		return limiter.CharLimit()
+	}
+	return gtransCharLimit
+}
+
+func translateContext(ctx context.Context, translator Translator, text, src, dest string) (string, error) {
+	if ctxTranslator, ok := translator.(ContextTranslator); ok {
+		return ctxTranslator.TranslateContext(ctx, text, src, dest)
+	}
+	return withContext(ctx, func() (string, error) {
+		return translator.Translate(text, src, dest)
+	})
+}
+
+func detectLanguageContext(ctx context.Context, translator Translator, text string) (string, float64, error) {
+	if ctxTranslator, ok := translator.(ContextTranslator); ok {
+		return ctxTranslator.DetectLanguageContext(ctx, text)
+	}
+	type detection struct {
+		lang       string
+		confidence float64
+	}
+	res, err := withContext(ctx, func() (detection, error) {
+		lang, confidence, err := translator.DetectLanguage(text)
+		return detection{lang, confidence}, err
+	})
+	return res.lang, res.confidence, err
+}
+
+func translateSegmentsContext(ctx context.Context, translator SegmentTranslator, batch, before, after []Segment, src, dest string) ([]Segment, error) {
+	if ctxTranslator, ok := translator.(ContextSegmentTranslator); ok {
+		return ctxTranslator.TranslateSegmentsContext(ctx, batch, before, after, src, dest)
+	}
+	return withContext(ctx, func() ([]Segment, error) {
+		return translator.TranslateSegments(batch, before, after, src, dest)
+	})
+}
+
+// withContext returns as soon as ctx is done, leaving fn to finish on the
+// background
+func withContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	type result struct {
+		val T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, err := fn()
+		done <- result{val, err}
+	}()
+	select {
+	case res := <-done:
+		return res.val, res.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
@@ -1,25 +1,43 @@
 package transub
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	gtrans "github.com/lcapuano-app/go-googletrans"
 )
 
 type Options struct {
-	RemoveCC     bool
-	LanguageSrc  string
-	OutputDir    string
-	IsMainSub    bool
-	RemoveOrigin bool
-	Retries      int
-	GTrans       GTransCfg
+	RemoveCC        bool
+	LanguageSrc     string
+	OutputDir       string
+	IsMainSub       bool
+	RemoveOrigin    bool
+	Retries         int
+	FPS             float64
+	OutputFormat    Format
+	OutputEncoding  Encoding
+	OutputBOM       bool
+	Backend         string
+	GTrans          GTransCfg
+	LibreTranslate  LibreTranslateCfg
+	DeepL           DeepLCfg
+	LLM             LLMCfg
+	Translator      Translator
+	Memory          *Memory
+	Glossary        *Glossary
+	ProjectGlossary string
+	Bilingual       BilingualCfg
+	Sentences       SentenceCfg
+	Reflow          ReflowCfg
+	Timing          TimingCfg
 }
 type withOptions = func(*Options)
 type GTransCfg = gtrans.Config
@@ -28,12 +46,19 @@ type Transub struct {
 	InputFile    string
 	OutputFile   string
 	LanguageDest string
-	FileExt      string
-	MetaStr      string
+	// LanguagesDest has every target language, in the same order as their
+	// OutputFiles. LanguageDest and OutputFile are the first ones
+	LanguagesDest []string
+	OutputFiles   []string
+	FileExt       string
+	MetaStr       string
+	srcEncoding   textEncoding
+	backend       string
+	// opts are set once by New, LanguageSrc is then updated with the
+	// detected source language
+	opts Options
 }
 
-var opts Options
-
 func WithRemoveCC(removeCC bool) func(*Options) {
 	return func(opt *Options) {
 		opt.RemoveCC = removeCC
@@ -64,6 +89,42 @@ func WithOutputDir(outputDir string) func(*Options) {
 	}
 }
 
+// WithFPS sets the frame rate of frame based subtitles (MicroDVD) that
+// have no {1}{1}fps header
+func WithFPS(fps float64) func(*Options) {
+	return func(opt *Options) {
+		opt.FPS = fps
+	}
+}
+
+// WithOutputFormat converts the translation to another subtitle format
+func WithOutputFormat(format Format) func(*Options) {
+	return func(opt *Options) {
+		opt.OutputFormat = Format(strings.ToLower(string(format)))
+		if extFormat, ok := FormatFromExt(string(format)); ok {
+			opt.OutputFormat = extFormat
+		}
+	}
+}
+
+// WithOutputEncoding writes the translation as enc. EncodingSource keeps the
+// input file encoding. Defaults to UTF-8
+func WithOutputEncoding(enc Encoding) func(*Options) {
+	return func(opt *Options) {
+		opt.OutputEncoding = enc
+		if parsed, ok := ParseEncoding(string(enc)); ok {
+			opt.OutputEncoding = parsed
+		}
+	}
+}
+
+// WithOutputBOM writes a byte order mark on UTF-8 and UTF-16 outputs
+func WithOutputBOM(bom bool) func(*Options) {
+	return func(opt *Options) {
+		opt.OutputBOM = bom
+	}
+}
+
 func WithGoogleTransCfg(cfg GTransCfg) func(*Options) {
 	return func(opt *Options) {
 		opt.GTrans = cfg
@@ -84,103 +145,389 @@ func WithGoogleRetries(retries int) func(*Options) {
 }
 
 func New(filename, destLang string, options ...withOptions) *Transub {
-	opts = Options{}
-	opts.LanguageSrc = "auto"
-	opts.Retries = 0
+	return NewMultiLang(filename, []string{destLang}, options...)
+}
+
+// NewMultiLang translates filename to every destLangs language. The source
+// is parsed and its language detected once, then each language gets its
+// own output file
+func NewMultiLang(filename string, destLangs []string, options ...withOptions) *Transub {
 	tsub := Transub{}
+	tsub.opts.LanguageSrc = "auto"
+	tsub.opts.Retries = 0
 	tsub.InputFile = filename
 	tsub.FileExt = filepath.Ext(filename)
 	tsub.OutputFile = ""
 
 	for _, optFn := range options {
-		optFn(&opts)
+		optFn(&tsub.opts)
+	}
+	isCustom := tsub.opts.Translator != nil
+	if !isCustom {
+		tsub.opts.Translator = newBackendTranslator(tsub.opts)
 	}
+	tsub.backend = backendName(tsub.opts.Backend, isCustom)
 
-	tsub.setLanguageDest(destLang)
-	tsub.setOutputFilename()
-	tsub.setMetaStr()
+	for _, destLang := range destLangs {
+		tsub.setLanguageDest(destLang)
+		tsub.addLanguageDest(tsub.LanguageDest)
+	}
+	if len(tsub.LanguagesDest) == 0 {
+		tsub.setLanguageDest("")
+		tsub.addLanguageDest(tsub.LanguageDest)
+	}
+	tsub.setLanguage(0)
 
 	return &tsub
 }
 
-func (ts *Transub) TranslateSSA() error {
+// addLanguageDest skips repeated languages
+func (ts *Transub) addLanguageDest(lang string) {
+	for _, dest := range ts.LanguagesDest {
+		if dest == lang {
+			return
+		}
+	}
+	ts.LanguagesDest = append(ts.LanguagesDest, lang)
+	ts.LanguageDest = lang
+	ts.setOutputFilename()
+	ts.OutputFiles = append(ts.OutputFiles, ts.OutputFile)
+}
+
+// setLanguage makes the idx target language the current LanguageDest,
+// OutputFile and MetaStr
+func (ts *Transub) setLanguage(idx int) {
+	ts.LanguageDest = ts.LanguagesDest[idx]
+	ts.OutputFile = ts.OutputFiles[idx]
+	ts.setMetaStr()
+}
+
+// Translate picks the subtitle format from the input file extension
+func (ts *Transub) Translate() (*Result, error) {
+	return ts.TranslateContext(context.Background())
+}
+
+// TranslateContext is Translate stopping as soon as ctx is done. Requests
+// in flight are cancelled and, unless the source was already marked as
+// translated, no output is left behind
+func (ts *Transub) TranslateContext(ctx context.Context) (*Result, error) {
+	format, ok := FormatFromExt(ts.FileExt)
+	if !ok {
+		return &Result{Backend: ts.backend}, fmt.Errorf("%w: unsupported extension '%s'", ErrNotSubtitle, ts.FileExt)
+	}
+	return ts.translateFile(ctx, format)
+}
+
+func (ts *Transub) TranslateSSA() (*Result, error) {
+	return ts.TranslateSSAContext(context.Background())
+}
+
+func (ts *Transub) TranslateSSAContext(ctx context.Context) (*Result, error) {
+	return ts.translateFile(ctx, FormatSSA)
+}
+
+func (ts *Transub) TranslateASS() (*Result, error) {
+	return ts.TranslateASSContext(context.Background())
+}
+
+func (ts *Transub) TranslateASSContext(ctx context.Context) (*Result, error) {
+	return ts.translateFile(ctx, FormatASS)
+}
+
+func (ts *Transub) TranslateVTT() (*Result, error) {
+	return ts.TranslateVTTContext(context.Background())
+}
+
+func (ts *Transub) TranslateVTTContext(ctx context.Context) (*Result, error) {
+	return ts.translateFile(ctx, FormatVTT)
+}
+
+func (ts *Transub) TranslasteSRT() (*Result, error) {
+	return ts.TranslateSRTContext(context.Background())
+}
+
+func (ts *Transub) TranslateSRTContext(ctx context.Context) (*Result, error) {
+	return ts.translateFile(ctx, FormatSRT)
+}
+
+// translateFile always returns a Result, on errors it has what was done
+// until then
+func (ts *Transub) translateFile(ctx context.Context, format Format) (*Result, error) {
+	res := &Result{Backend: ts.backend}
+	start := time.Now()
+	defer func() {
+		res.Duration = time.Since(start)
+	}()
 
-	translateds, err := translateSSA(ts)
+	doc, err := ts.parseSource(format)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return res, err
+	}
+	if err = ts.detectSource(ctx, doc, res); err != nil {
+		return res, err
 	}
 
-	if err = ts.CreateOutputFile(translateds); err != nil {
-		return err
+	// fan out the translations, outputs are written one at a time
+	translateds := make([]*Document, len(ts.LanguagesDest))
+	langResults := make([]*Result, len(ts.LanguagesDest))
+	errs := make([]error, len(ts.LanguagesDest))
+	var wg sync.WaitGroup
+	for i, lang := range ts.LanguagesDest {
+		if lang == ts.opts.LanguageSrc {
+			errs[i] = fmt.Errorf("[transub] %s is already in '%s'", ts.InputFile, lang)
+			res.warn(WarnSameLanguage, lang, "the source is already in '%s', skipped", lang)
+			continue
+		}
+		if _, err := os.Stat(ts.OutputFiles[i]); err == nil {
+			errs[i] = fmt.Errorf("%w: %s", ErrOutputExists, ts.OutputFiles[i])
+			res.warn(WarnOutputExists, lang, "%s already exists, skipped", ts.OutputFiles[i])
+			continue
+		}
+		wg.Add(1)
+		go func(i int, lang string) {
+			defer wg.Done()
+			translateds[i], langResults[i], errs[i] = ts.translateDocument(ctx, doc, lang)
+		}(i, lang)
+	}
+	wg.Wait()
+	for _, langRes := range langResults {
+		res.add(langRes)
+	}
+	if err = ctx.Err(); err != nil {
+		return res, err
+	}
+
+	// a cancelled or failed run removes the outputs it wrote
+	var written []string
+	removeWritten := func() {
+		for _, filename := range written {
+			if err := os.Remove(filename); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	created := -1
+	for i, translated := range translateds {
+		if errs[i] != nil {
+			if langResults[i] != nil {
+				res.warn(WarnLanguageFailed, ts.LanguagesDest[i], "%s", errs[i])
+			}
+			err = errs[i]
+			continue
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			removeWritten()
+			return res, ctxErr
+		}
+		ts.setLanguage(i)
+		if err = writeFileAtomic(ts.OutputFile, ts.encodeOutput(translated.Lines(), res)); err != nil {
+			removeWritten()
+			return res, err
+		}
+		written = append(written, ts.OutputFile)
+		if created < 0 {
+			created = i
+		}
 	}
+	if created < 0 {
+		return res, err
+	}
+	ts.setLanguage(created)
 
+	if err = ctx.Err(); err != nil {
+		removeWritten()
+		return res, err
+	}
 	if err = ts.MarkOriginAsTrasnlated(); err != nil {
-		return err
+		removeWritten()
+		return res, err
 	}
 
 	if err = ts.ManageOriginDestFiles(); err != nil {
-		return err
+		return res, err
 	}
+	// the main subtitle was renamed
+	written[0] = ts.OutputFile
+	res.OutputFile = ts.OutputFile
+	res.OutputFiles = written
 
-	return nil
+	return res, nil
 }
 
-func (ts *Transub) TranslasteSRT() error {
-	fmt.Println("RAMO LA", ts.InputFile)
-	translateds, err := translasteSRT(ts)
+// parseSource reads and parses the input file, once for every language
+func (ts *Transub) parseSource(format Format) (*Document, error) {
+	if err := ts.validateTranslationSourceDest(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(ts.InputFile)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return nil, err
 	}
+	return ts.parseData(data, format)
+}
 
-	if err = ts.CreateOutputFile(translateds); err != nil {
-		return err
+// parseData decodes and parses a subtitle, applying the frame rate, timing
+// and close captions options
+func (ts *Transub) parseData(data []byte, format Format) (*Document, error) {
+	var fileLines []string
+	fileLines, ts.srcEncoding = decodeLines(data)
+	if len(fileLines) == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrNotSubtitle)
 	}
-
-	if err = ts.MarkOriginAsTrasnlated(); err != nil {
-		return err
+	if err := CheckForMetaStr(fileLines); err != nil {
+		return nil, err
 	}
 
-	if err = ts.ManageOriginDestFiles(); err != nil {
-		return err
+	doc, err := ParseDocument(fileLines, format)
+	if err != nil {
+		return nil, err
+	}
+	if ts.opts.FPS > 0 && doc.Meta[metaFPSHeader] != "true" {
+		doc.SetFrameRate(ts.opts.FPS)
 	}
-	// fileAsStrArr, err := []string{}, nil // ts.translatePrepare(".srt")
-	// if err != nil {
-	// 	return err
-	// }
+	if err = doc.ApplyTiming(ts.opts.Timing); err != nil {
+		return nil, err
+	}
+	if ts.opts.RemoveCC {
+		doc.removeCC()
+	}
+	return doc, nil
+}
 
-	// originals, translatables, err := extractSRTSpeechLines(fileAsStrArr, opts.RemoveCC)
-	// if err != nil {
-	// 	return err
-	// }
+// detectSource updates the source language from a sample of doc. Only a
+// done ctx is an error, a failed detection keeps the current language
+func (ts *Transub) detectSource(ctx context.Context, doc *Document, res *Result) error {
+	segments := doc.sampleSegments(ts.opts.RemoveCC)
+	if err := ts.updateSrcLang(ctx, segments, res); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		res.warn(WarnDetectionFailed, "", "%s. I'll keep using '%s'", err, ts.opts.LanguageSrc)
+	}
+	res.SourceLanguage = ts.opts.LanguageSrc
+	return nil
+}
 
-	// joinedSpeeches := joinSpeechesByCharLimit(translatables)
-	// if len(joinedSpeeches) == 0 {
-	// 	err = fmt.Errorf("[transub] zero translatable lines in file. %s", ts.InputFile)
-	// 	return err
-	// }
+// sampleSegments are the texts sent to translation, used to detect the
+// source language
+func (doc *Document) sampleSegments(removeCC bool) []Segment {
+	sample := doc.originalCopy()
+	sample.protectMarkup()
+	return sample.translatableSegments(removeCC)
+}
 
-	// if err = ts.updateSrcLang(joinedSpeeches); err != nil {
-	// 	return err
-	// }
+// translateDocument translates a copy of doc to dest, leaving doc untouched.
+// The Result has the cue counts and warnings of dest
+func (ts *Transub) translateDocument(ctx context.Context, src *Document, dest string) (*Document, *Result, error) {
+	var err error
+	res := &Result{}
+	doc := src.originalCopy()
+	var original *Document
+	if ts.opts.Bilingual.Enabled {
+		original = src.originalCopy()
+	}
+
+	doc.protectMarkup()
+	segments := doc.translatableSegments(ts.opts.RemoveCC)
+	for _, cue := range doc.Cues {
+		if cue.Meta[metaRaw] != "true" {
+			res.Skipped++
+		}
+	}
+	res.Skipped -= len(segments)
+	// a segment is a cue, or every cue of a merged sentence
+	segmentCues := map[int]int{}
+	for _, seg := range segments {
+		segmentCues[seg.ID] = 1
+	}
+	var sentences []sentence
+	if ts.opts.Sentences.Enabled {
+		sentences = doc.mergeSentences(segments, ts.opts.Sentences)
+		segments = make([]Segment, len(sentences))
+		for i, sent := range sentences {
+			segments[i] = sent.seg
+			segmentCues[sent.seg.ID] = len(sent.parts)
+		}
+	}
+	stats := &translationStats{}
+	translateds := ts.translateGlossary(ctx, doc, segments, dest, stats, res)
+	if ts.opts.Sentences.Enabled {
+		var unsplit []Segment
+		translateds, unsplit = doc.splitSentences(sentences, translateds, ts.opts.Sentences)
+		if len(unsplit) > 0 {
+			ids := make([]int, len(unsplit))
+			for i, seg := range unsplit {
+				ids[i] = seg.ID
+				segmentCues[seg.ID] = 1
+			}
+			stats.forget(ids...)
+			translateds = append(translateds, ts.translateGlossary(ctx, doc, unsplit, dest, stats, res)...)
+		}
+	}
+	doc.mergeTranslatedSegments(translateds)
+	doc.restoreMarkup()
 
-	// translatedSpeeches := translateMany(joinedSpeeches, opts.LanguageSrc, ts.LanguageDest, opts.Retries)
-	// translateds := rebuildAsOriginalLinesSRT(translatedSpeeches, originals)
+	res.CharsSent = stats.charsSent
+	for _, id := range stats.cached {
+		res.Cached += segmentCues[id]
+	}
+	for _, id := range stats.failed {
+		res.Failed += segmentCues[id]
+	}
+	res.Translated = len(segmentCues) - res.Cached - res.Failed
+	if res.Failed > 0 {
+		res.warn(WarnUntranslated, dest, "%d cues kept untranslated", res.Failed)
+	}
 
-	// if err = ts.CreateOutputFile(translateds); err != nil {
-	// 	return err
-	// }
+	if len(ts.opts.OutputFormat) > 0 && ts.opts.OutputFormat != doc.Format {
+		if doc, err = Convert(doc, ts.opts.OutputFormat); err != nil {
+			return nil, res, err
+		}
+		if original != nil {
+			if original, err = Convert(original, ts.opts.OutputFormat); err != nil {
+				return nil, res, err
+			}
+		}
+	}
+	if ts.opts.Reflow.Enabled {
+		for _, issue := range doc.Reflow(ts.opts.Reflow) {
+			res.warn(WarnReflow, dest, "%s", strings.TrimPrefix(issue.String(), "[reflow] "))
+		}
+	}
+	if original != nil {
+		doc.mergeBilingual(original, ts.opts.Bilingual)
+	}
 
-	// if err = ts.MarkOriginAsTrasnlated(); err != nil {
-	// 	return err
-	// }
+	return doc, res, nil
+}
 
-	// if err = ts.ManageOriginDestFiles(); err != nil {
-	// 	return err
-	// }
+// translateGlossary translates segments with their glossary terms protected,
+// warning about the terms the translator lost
+func (ts *Transub) translateGlossary(ctx context.Context, doc *Document, segments []Segment, dest string, stats *translationStats, res *Result) []Segment {
+	protected, terms := ts.glossary().protectSegments(segments, ts.opts.LanguageSrc, dest)
+	translateds := ts.opts.Memory.translateSegments(ctx, protected, ts.backend, ts.opts.LanguageSrc, dest, ts.opts.Translator, stats)
+	translateds, lost := restoreGlossary(translateds, terms)
+	for _, term := range lost {
+		res.warn(WarnGlossaryTermLost, dest, "cue %d lost the term '%s'", doc.cueNumber(term.ID), term.Term)
+	}
+	return translateds
+}
 
-	return nil
+// glossary merges the nearest project glossary over Options.Glossary
+func (ts *Transub) glossary() *Glossary {
+	if len(ts.opts.ProjectGlossary) == 0 || len(ts.InputFile) == 0 {
+		return ts.opts.Glossary
+	}
+	path := findProjectGlossary(ts.InputFile, ts.opts.ProjectGlossary)
+	if len(path) == 0 {
+		return ts.opts.Glossary
+	}
+	project, err := LoadGlossary(path)
+	if err != nil {
+		log.Println(err)
+		return ts.opts.Glossary
+	}
+	return ts.opts.Glossary.Merge(project)
 }
 
 // func (ts *Transub) translatePrepare(ext string) (fileLines []string, err error) {
@@ -212,93 +559,112 @@ func (ts *Transub) TranslasteSRT() error {
 // 	return fileLines, nil
 // }
 
-func (ts *Transub) updateSrcLang(sample []string) error {
-	detectedSrcLang, err := detectSourceLanguage(sample[0])
+func (ts *Transub) updateSrcLang(ctx context.Context, segments []Segment, res *Result) error {
+	if len(segments) == 0 {
+		return fmt.Errorf("[transub] zero translatable lines in file. %s", ts.InputFile)
+	}
+	var sample []string
+	for _, seg := range segments {
+		sample = append(sample, strings.ReplaceAll(seg.Text, LN_SEP, " "))
+	}
+	text := detectionSample(strings.Join(sample, LN_BREAK))
+	res.CharsSent += utf8.RuneCountInString(text)
+	detectedSrcLang, confidence, err := detectLanguageContext(ctx, ts.opts.Translator, text)
 	if err != nil {
 		return err
 	}
+	res.Confidence = confidence
 
-	if detectedSrcLang != opts.LanguageSrc && opts.LanguageSrc != "auto" {
-		warn := fmt.Sprintf(
-			"[Warning] - using '%s' as src language instead of '%s'",
-			detectedSrcLang,
-			opts.LanguageSrc,
-		)
-		log.Println(warn)
-	}
-
-	opts.LanguageSrc = detectedSrcLang
-
-	if ts.LanguageDest == detectedSrcLang {
-		err := fmt.Errorf(
-			"[transub] this file (%s) was written into dest language. (%s)",
-			ts.InputFile,
-			detectedSrcLang,
-		)
-		return err
+	if detectedSrcLang != ts.opts.LanguageSrc && ts.opts.LanguageSrc != "auto" {
+		res.warn(WarnLanguageMismatch, "", "using '%s' as src language instead of '%s'", detectedSrcLang, ts.opts.LanguageSrc)
 	}
 
+	ts.opts.LanguageSrc = detectedSrcLang
 	return nil
 }
 
 func (ts *Transub) CreateOutputFile(strLines []string) error {
+	return writeFileAtomic(ts.OutputFile, ts.encodeOutput(strLines, nil))
+}
 
-	file, err := os.OpenFile(ts.OutputFile, fileEditFlag, 0666)
-	if err != nil {
-		return err
-	}
+// encodeOutput appends the meta string to the lines and encodes them as
+// the output options say, falling back to UTF-8. The fallback is a res
+// warning, or a log line without res
+func (ts *Transub) encodeOutput(strLines []string, res *Result) []byte {
 	strLines = append(strLines, LN_BREAK+ts.MetaStr)
-	datawriter := bufio.NewWriter(file)
-	for _, text := range strLines {
-		// if opts.RemoveCC && Validator.isCC(text) {
-		// 	continue
-		// }
-		if _, err := datawriter.WriteString(text + "\n"); err != nil {
-			log.Println(err)
+	enc := ts.outputEncoding()
+	data, err := encodeLines(strLines, enc)
+	if err != nil {
+		if res != nil {
+			res.warn(WarnEncodingFallback, ts.LanguageDest, "%s. Written as UTF-8", err)
+		} else {
+			log.Printf("%s. Writing the %s translation as UTF-8", err, ts.LanguageDest)
 		}
-
-	}
-	if err = datawriter.Flush(); err != nil {
-		return err
+		// legacy codepages have no BOM, their fallback neither
+		data, _ = encodeLines(strLines, textEncoding{encoding: EncodingUTF8, bom: enc.bom, lineBreak: enc.lineBreak})
 	}
-	if err = file.Close(); err != nil {
+	return data
+}
+
+// writeFileAtomic writes to a temporary file renamed over filename, so an
+// interrupted write never leaves half a subtitle behind
+func writeFileAtomic(filename string, data []byte) error {
+	tmpFilename := filename + ".tmp"
+	if err := os.WriteFile(tmpFilename, data, 0666); err != nil {
+		os.Remove(tmpFilename)
 		return err
 	}
-	return nil
+	return os.Rename(tmpFilename, filename)
 }
 
+// MarkOriginAsTrasnlated appends the meta string to the source file keeping
+// its encoding and line breaks
 func (ts *Transub) MarkOriginAsTrasnlated() error {
-	filelines, err := getFileStrLines(ts.InputFile)
+	filelines, enc, err := readTextFile(ts.InputFile)
 	if err != nil {
 		return err
 	}
-	metaStr := fmt.Sprintf("%s;%s\n", META_TRASNLATED, opts.LanguageSrc)
+	srcFormat, _ := FormatFromExt(ts.FileExt)
+	metaStr := formatMetaStr(ts.opts.LanguageSrc, srcFormat) + "\n"
 	filelines = append(filelines, LN_BREAK+metaStr)
-
-	if err = os.Remove(ts.InputFile); err != nil {
-		return err
+	if ts.opts.RemoveCC && !ts.hasBracketHeaders() {
+		for i, text := range filelines {
+			filelines[i] = Validator.removeCC(text)
+		}
 	}
-	file, err := os.OpenFile(ts.InputFile, fileEditFlag, 0666)
+	data, err := encodeLines(filelines, enc)
 	if err != nil {
 		return err
 	}
-	datawriter := bufio.NewWriter(file)
-	for _, text := range filelines {
-		if opts.RemoveCC && ts.FileExt != ".ssa" {
-			text = Validator.removeCC(text)
-		}
-		if _, err := datawriter.WriteString(text + "\n"); err != nil {
-			log.Println(err)
-		}
 
+	return writeFileAtomic(ts.InputFile, data)
+}
+
+// outputEncoding resolves Options.OutputEncoding against the source file.
+// Line breaks always follow the source
+func (ts *Transub) outputEncoding() textEncoding {
+	enc := textEncoding{encoding: EncodingUTF8, lineBreak: ts.srcEncoding.lineBreak}
+	switch ts.opts.OutputEncoding {
+	case "":
+	case EncodingSource:
+		if len(ts.srcEncoding.encoding) > 0 {
+			enc.encoding = ts.srcEncoding.encoding
+			enc.bom = ts.srcEncoding.bom
+		}
+	default:
+		enc.encoding = ts.opts.OutputEncoding
 	}
-	if err = datawriter.Flush(); err != nil {
-		return err
-	}
-	if err = file.Close(); err != nil {
-		return err
+	if ts.opts.OutputBOM && enc.isUnicode() {
+		enc.bom = true
 	}
-	return nil
+	return enc
+}
+
+// hasBracketHeaders checks for .ssa, .ass and .sub (SubViewer) files, which
+// section headers looks like close captions
+func (ts *Transub) hasBracketHeaders() bool {
+	format, _ := FormatFromExt(ts.FileExt)
+	return format == FormatSSA || format == FormatASS || format == FormatMicroDVD
 }
 
 func (ts *Transub) ManageOriginDestFiles() error {
@@ -306,37 +672,40 @@ func (ts *Transub) ManageOriginDestFiles() error {
 
 	// Keep translation and delete original file while changing the
 	// translated file name to the original file name
-	if opts.IsMainSub && opts.RemoveOrigin {
+	mainFile := removeFileExtension(ts.InputFile, ts.FileExt) + filepath.Ext(ts.OutputFile)
+	if ts.opts.IsMainSub && ts.opts.RemoveOrigin {
 		err = os.Remove(ts.InputFile)
 		if err != nil {
 			return err
 		}
-		err = os.Rename(ts.OutputFile, ts.InputFile)
+		err = os.Rename(ts.OutputFile, mainFile)
 		if err != nil {
 			return err
 		}
+		ts.OutputFile = mainFile
 		return nil
 	}
 
 	// Keep both files but change the translated file name to original file name
 	// and rename the original file to file.language.srt
-	if opts.IsMainSub && !opts.RemoveOrigin {
+	if ts.opts.IsMainSub && !ts.opts.RemoveOrigin {
 		noExtFilename := removeFileExtension(ts.InputFile, ts.FileExt)
-		renamedPath := fmt.Sprintf("%s.%s%s", noExtFilename, opts.LanguageSrc, ts.FileExt)
+		renamedPath := fmt.Sprintf("%s.%s%s", noExtFilename, ts.opts.LanguageSrc, ts.FileExt)
 		err = os.Rename(ts.InputFile, renamedPath)
 		if err != nil {
 			return err
 		}
-		err = os.Rename(ts.OutputFile, ts.InputFile)
+		err = os.Rename(ts.OutputFile, mainFile)
 		if err != nil {
 			return err
 		}
+		ts.OutputFile = mainFile
 		return nil
 	}
 
 	// Keep translated file as filename.transLang.srt
 	// and remove the original file
-	if opts.RemoveOrigin {
+	if ts.opts.RemoveOrigin {
 		err = os.Remove(ts.InputFile)
 		return err
 	}
@@ -345,34 +714,15 @@ func (ts *Transub) ManageOriginDestFiles() error {
 	return nil
 }
 
-func (ts *Transub) getSourceFileLines() (fileLines []string, err error) {
-
-	if err := ts.validateTranslationSourceDest(); err != nil {
-		return fileLines, err
-	}
-
-	fileLines, err = getFileStrLines(ts.InputFile)
-	if err != nil {
-		return fileLines, err
-	}
-	if len(fileLines) == 0 {
-		return fileLines, fmt.Errorf("empty file")
-	}
-
-	if err = CheckForMetaStr(fileLines); err != nil {
-		return fileLines, err
-	}
-
-	return fileLines, nil
-}
-
 func (ts *Transub) validateTranslationSourceDest() error {
 	if !Validator.isReachableFile(ts.InputFile) {
 		return fmt.Errorf("unreachable %s file: %s", ts.FileExt, ts.InputFile)
 	}
 
-	if Validator.isTranslatedFilename(ts.InputFile, ts.LanguageDest) {
-		return fmt.Errorf("this file apears to be a translation: %s", ts.InputFile)
+	for _, lang := range ts.LanguagesDest {
+		if Validator.isTranslatedFilename(ts.InputFile, lang) {
+			return fmt.Errorf("%w: %s apears to be a translation", ErrAlreadyTranslated, ts.InputFile)
+		}
 	}
 
 	ok, err := Validator.isTextFile(ts.InputFile)
@@ -380,14 +730,15 @@ func (ts *Transub) validateTranslationSourceDest() error {
 		return err
 	}
 	if !ok {
-		return fmt.Errorf("this is not a valid subtitle file [%s]", ts.InputFile)
+		return fmt.Errorf("%w: %s", ErrNotSubtitle, ts.InputFile)
 	}
 
-	if _, err := os.Stat(ts.OutputFile); err == nil {
-		return fmt.Errorf("output file %s already exists", ts.OutputFile)
+	for _, outputFile := range ts.OutputFiles {
+		if _, err := os.Stat(outputFile); err != nil {
+			return nil
+		}
 	}
-
-	return nil
+	return fmt.Errorf("%w: %s", ErrOutputExists, strings.Join(ts.OutputFiles, ", "))
 }
 
 func (ts *Transub) setOutputFilename() {
@@ -396,8 +747,11 @@ func (ts *Transub) setOutputFilename() {
 		ts.LanguageDest,
 		ts.FileExt,
 	)
-	if len(opts.OutputDir) > 0 {
-		ts.OutputFile = filepath.Join(opts.OutputDir, outName)
+	if len(ts.opts.OutputFormat) > 0 {
+		outName = removeFileExtension(outName, ts.FileExt) + FormatExt(ts.opts.OutputFormat)
+	}
+	if len(ts.opts.OutputDir) > 0 {
+		ts.OutputFile = filepath.Join(ts.opts.OutputDir, outName)
 	} else {
 		ts.OutputFile = filepath.Join(outDir, outName)
 	}
@@ -414,26 +768,51 @@ func (ts *Transub) setLanguageDest(destLang string) {
 }
 
 func (ts *Transub) setMetaStr() {
-	metaStr := fmt.Sprintf("\n%s;%s\n", META_TRASNLATED, ts.LanguageDest)
+	metaStr := fmt.Sprintf("\n%s\n", formatMetaStr(ts.LanguageDest, ts.outputFormat()))
 	ts.MetaStr = metaStr
 }
 
+// outputFormat is the source format unless another one was asked
+func (ts *Transub) outputFormat() Format {
+	if len(ts.opts.OutputFormat) > 0 {
+		return ts.opts.OutputFormat
+	}
+	format, _ := FormatFromExt(ts.FileExt)
+	return format
+}
+
+// formatMetaStr uses a xml comment on xml based formats, any other text
+// after the root element would make them invalid
+func formatMetaStr(lang string, format Format) string {
+	metaStr := fmt.Sprintf("%s;%s", META_TRASNLATED, lang)
+	if format == FormatTTML || format == FormatDFXP {
+		return "<!-- " + metaStr + " -->"
+	}
+	return metaStr
+}
+
 func CheckForMetaStr(fileLines []string) error {
 	err := fmt.Errorf(
-		"file already translated. If this is a false positive, please, "+
+		"%w. If this is a false positive, please, "+
 			"locate and remove this text line: '%s' (should be the last entry)",
+		ErrAlreadyTranslated,
 		META_TRASNLATED,
 	)
 
+	isMetaStr := func(line string) bool {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "<!--"))
+		return strings.HasPrefix(line, META_TRASNLATED)
+	}
+
 	lastIdx := len(fileLines) - 1
-	if strings.HasPrefix(fileLines[lastIdx], META_TRASNLATED) {
+	if isMetaStr(fileLines[lastIdx]) {
 
 		return err
 	}
 
 	for i := lastIdx; i >= 0; i-- {
 		ln := fileLines[i]
-		if strings.HasPrefix(ln, META_TRASNLATED) {
+		if isMetaStr(ln) {
 			return err
 		}
 		if Validator.isIntStr(ln) {
@@ -463,6 +842,9 @@ func removeLangFromFilename(filename, ext string) string {
 
 func removeFileExtension(filename, ext string) string {
 	idx := strings.LastIndex(filename, ext)
+	if idx < 0 || len(ext) == 0 {
+		return filename
+	}
 	filenameRmExt := filename[:idx] + strings.Replace(filename[idx:], ext, "", 1)
 	return filenameRmExt
 }
@@ -522,23 +904,8 @@ func getOutputFileNameAndDir(filename, dest, ext string) (fname, fdir string) {
 // }
 
 func getFileStrLines(filename string) ([]string, error) {
-	var lines []string
-	readFile, err := os.Open(filename)
-	if err != nil {
-		return lines, err
-	}
-
-	fileScanner := bufio.NewScanner(readFile)
-	fileScanner.Split(bufio.ScanLines)
-	for fileScanner.Scan() {
-		line := strings.Trim(fileScanner.Text(), "\ufeff")
-		line = strings.TrimSpace(line)
-		lines = append(lines, line)
-	}
-	if err := readFile.Close(); err != nil {
-		return lines, err
-	}
-	return lines, nil
+	lines, _, err := readTextFile(filename)
+	return lines, err
 }
 
 // func joinSpeechesByCharLimit(speeches []string) []string {
@@ -558,81 +925,22 @@ func getFileStrLines(filename string) ([]string, error) {
 // 	return chuncks
 // }
 
-func detectSourceLanguage(text string) (string, error) {
-	getSample := func(text string) string {
-		sz := 80
-		if len(text) <= sz {
-			return text
-		}
-		textSlice := text[:sz]
-		idx := len(textSlice) - 1
-		for i := idx; i >= 0; i-- {
-			strI := string(textSlice[i])
-			if strI == " " || strI == LN_BREAK {
-				idx = i
-				break
-			}
-		}
-		return textSlice[:idx]
-	}
-	sample := getSample(text)
-	translator := gtrans.New(opts.GTrans)
-	res, err := translator.DetectLanguage(sample, "auto")
-	if err != nil {
-		return "", err
-	}
-	if res.Confidence < 0.3 {
-		return res.Src, err
-	}
-	return res.Src, nil
-}
-
-func translateMany(texts []string, src, dest string, retries int) []string {
-	ch := make(chan string)
-	var translateds []string
-	var wg sync.WaitGroup
-	wg.Add(len(texts))
-	for _, text := range texts {
-		gTranslator := *gtrans.New(opts.GTrans)
-		go translateOneWG(text, src, dest, retries, gTranslator, &wg, ch)
-	}
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-	for res := range ch {
-		translateds = append(translateds, res)
-	}
-	return translateds
-}
-
-func translateOneWG(text, src, dest string, retries int, gTranslator gtrans.Translator, wg *sync.WaitGroup, ch chan<- string) {
-	defer wg.Done()
-	translatedText := translateOne(text, src, dest, retries, gTranslator)
-	ch <- translatedText
-}
-
-func translateOne(text, src, dest string, retries int, gTranslator gtrans.Translator) string {
-	result, err := gTranslator.Translate(text, src, dest)
-	if err == nil {
-		return result.Text
-	}
-
-	if err != nil && retries <= 0 {
-		log.Println(err, "no retries attempts left, returning original text")
+// detectionSample cuts text at the last word break of its first 80 bytes
+func detectionSample(text string) string {
+	sz := 80
+	if len(text) <= sz {
 		return text
 	}
-
-	msg := fmt.Sprintf("will attempt with a diferent service url and user agent. attempts left [%d]", retries)
-	log.Println(err, msg)
-	retries--
-
-	gTranslator = *gtrans.New(gtrans.Config{
-		ServiceUrls: gtrans.GetDefaultServiceUrls(),
-		UserAgent:   []string{},
-		Proxy:       opts.GTrans.Proxy,
-	})
-	return translateOne(text, src, dest, retries, gTranslator)
+	textSlice := text[:sz]
+	idx := len(textSlice) - 1
+	for i := idx; i >= 0; i-- {
+		strI := string(textSlice[i])
+		if strI == " " || strI == LN_BREAK {
+			idx = i
+			break
+		}
+	}
+	return textSlice[:idx]
 }
 
 // func rebuildAsOriginalLinesSRT(translatedSpeeches, originals []string) []string {
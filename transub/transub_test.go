@@ -1,12 +1,45 @@
 package transub
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+type fakeTranslator struct {
+	lang string
+}
+
+func (f fakeTranslator) Translate(text, src, dest string) (string, error) {
+	return strings.ToUpper(text), nil
+}
+
+func (f fakeTranslator) DetectLanguage(text string) (string, float64, error) {
+	return f.lang, 1, nil
+}
+
+func copyExample(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("examples", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), name)
+	if err = os.WriteFile(filename, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
 func TestTransub_Translate(t *testing.T) {
 
-	filename := "examples/subtitle.srt"
+	filename := copyExample(t, "subtitle.srt")
 	destLanguage := "portuguese"
 	tr := New(
 		filename,
@@ -19,9 +52,175 @@ func TestTransub_Translate(t *testing.T) {
 		//WithOutputDir("another/dir/to/output/file"),
 	)
 
-	err := tr.TranslasteSRT()
+	_, err := tr.TranslasteSRT()
 	if err != nil {
 		t.Fatal(err)
 	}
 
 }
+
+func TestTransub_WithTranslator(t *testing.T) {
+	filename := copyExample(t, "subtitle.srt")
+	tr := New(filename, "pt", WithTranslator(fakeTranslator{lang: "en"}))
+
+	if _, err := tr.TranslasteSRT(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(tr.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"- HELLO WORLD!", "- I'LL THINK ABOUT IT", "00:01:48,083 --> 00:01:50,792"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestTransub_NewMultiLang(t *testing.T) {
+	filename := copyExample(t, "subtitle.srt")
+	tr := NewMultiLang(filename, []string{"pt", "es", "en", "pt"}, WithTranslator(fakeTranslator{lang: "en"}))
+	if len(tr.OutputFiles) != 3 {
+		t.Fatalf("expected pt, es and en outputs, got %q", tr.OutputFiles)
+	}
+
+	if _, err := tr.TranslasteSRT(); err != nil {
+		t.Fatal(err)
+	}
+
+	// english is the source language, there is nothing to translate
+	for i, want := range []bool{true, true, false} {
+		_, err := os.Stat(tr.OutputFiles[i])
+		if got := err == nil; got != want {
+			t.Errorf("output %s exists: %v, want %v", tr.OutputFiles[i], got, want)
+		}
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marks := strings.Count(string(src), META_TRASNLATED); marks != 1 {
+		t.Errorf("source marked %d times", marks)
+	}
+}
+
+func TestTransub_Concurrent(t *testing.T) {
+	srcLangs := []string{"en", "es", "fr", "de", "it", "nl"}
+	filenames := make([]string, len(srcLangs))
+	for i := range srcLangs {
+		filenames[i] = copyExample(t, "subtitle.srt")
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(srcLangs))
+	for i, srcLang := range srcLangs {
+		wg.Add(1)
+		go func(i int, srcLang string) {
+			defer wg.Done()
+			tr := New(filenames[i], "pt",
+				WithTranslator(fakeTranslator{lang: srcLang}),
+				WithRemoveCC(i%2 == 0),
+			)
+			_, errs[i] = tr.TranslasteSRT()
+		}(i, srcLang)
+	}
+	wg.Wait()
+
+	for i, srcLang := range srcLangs {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		src, err := os.ReadFile(filenames[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := META_TRASNLATED + ";" + srcLang; !strings.Contains(string(src), want) {
+			t.Errorf("%s was not marked as %s", filenames[i], want)
+		}
+	}
+}
+
+// cancelTranslator cancels the translation it is part of on the first call
+// and hangs like a stuck request would
+type cancelTranslator struct {
+	fakeTranslator
+	cancel context.CancelFunc
+}
+
+func (c cancelTranslator) Translate(text, src, dest string) (string, error) {
+	c.cancel()
+	time.Sleep(time.Second)
+	return text, nil
+}
+
+func TestTransub_TranslateContextCancel(t *testing.T) {
+	filename := copyExample(t, "subtitle.srt")
+	orig, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tr := NewMultiLang(filename, []string{"pt", "es"},
+		WithTranslator(cancelTranslator{fakeTranslator{lang: "en"}, cancel}),
+	)
+
+	start := time.Now()
+	if _, err := tr.TranslateSRTContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancel took %s", elapsed)
+	}
+
+	for _, output := range tr.OutputFiles {
+		if _, err := os.Stat(output); err == nil {
+			t.Errorf("cancelled translation left %s", output)
+		}
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, orig) {
+		t.Errorf("cancelled translation changed the source:\n%s", src)
+	}
+}
+
+// keepPTTranslator keeps the text on pt, like names that need no
+// translation, and writes any other language in upper case
+type keepPTTranslator struct {
+	fakeTranslator
+}
+
+func (k keepPTTranslator) Translate(text, src, dest string) (string, error) {
+	if dest == "pt" {
+		return text, nil
+	}
+	return strings.ToUpper(text), nil
+}
+
+func TestTransub_NewMultiLangTTML(t *testing.T) {
+	filename := copyExample(t, "subtitle.ttml")
+	tr := NewMultiLang(filename, []string{"es", "pt"}, WithTranslator(keepPTTranslator{fakeTranslator{lang: "en"}}))
+	if _, err := tr.Translate(); err != nil {
+		t.Fatal(err)
+	}
+
+	wants := map[string][]string{
+		"es": {">SOMETHING</p>", "HELLO <span", "PLEASE, TRANSLATE ALL<br/>MY SPEACH LINES"},
+		"pt": {">Something</p>", "Hello <span", "Please, translate all<br/>my speach lines"},
+	}
+	for i, lang := range tr.LanguagesDest {
+		out, err := os.ReadFile(tr.OutputFiles[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range wants[lang] {
+			if !strings.Contains(string(out), want) {
+				t.Errorf("%s output is missing %q:\n%s", lang, want, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package transub
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ttmlNode keeps the whole xml tree, so anything that is not translated
+// (head, styling, layout, metadata, namespaces...) is written back as it is
+type ttmlNode struct {
+	token    xml.Token
+	children []*ttmlNode
+}
+
+type ttmlTiming struct {
+	frameRate float64
+	subFrames float64
+	tickRate  float64
+}
+
+var (
+	// offset times like 10.5s, 200ms, 25f or 1000t
+	ttmlOffsetTimeRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)(h|ms|m|s|f|t)$`)
+	// clock times like 00:00:01.500 or 00:00:01:12 (frames)
+	ttmlClockTimeRe = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})(?:\.(\d+)|:(\d+)(?:\.(\d+))?)?$`)
+	ttmlBrRe        = regexp.MustCompile(`<(?:[\w.-]+:)?br(?:\s[^>]*)?/>`)
+	// spans and entities are protected during translation
+	ttmlTagRe  = regexp.MustCompile(`<[^>]+>|&[a-zA-Z0-9#]+;`)
+	ttmlSpaces = regexp.MustCompile(`\s+`)
+)
+
+// parseTTML reads TTML, DFXP and IMSC1 documents. Each <p> on the body
+// becomes a cue, its <span> and <br/> children are kept as inline markup
+func parseTTML(lines []string) (*Document, error) {
+	doc := &Document{Format: FormatTTML, Meta: map[string]string{}, Styles: map[string]map[string]string{}}
+
+	decoder := xml.NewDecoder(strings.NewReader(strings.Join(lines, LN_BREAK)))
+	root := &ttmlNode{}
+	stack := []*ttmlNode{root}
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return doc, fmt.Errorf("[transub] invalid ttml: %w", err)
+		}
+		parent := stack[len(stack)-1]
+		switch tk := token.(type) {
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.Comment:
+			if strings.Contains(string(tk), META_TRASNLATED) {
+				continue
+			}
+			parent.children = append(parent.children, &ttmlNode{token: tk.Copy()})
+		default:
+			node := &ttmlNode{token: xml.CopyToken(tk)}
+			parent.children = append(parent.children, node)
+			if _, ok := tk.(xml.StartElement); ok {
+				stack = append(stack, node)
+			}
+		}
+	}
+
+	tt := root.findElement("tt")
+	if tt == nil {
+		return doc, fmt.Errorf("[transub] missing <tt> root element. This might not be an actual ttml file")
+	}
+	timing := ttmlTiming{frameRate: 30, subFrames: 1, tickRate: 1}
+	if rate, err := strconv.ParseFloat(tt.attr("frameRate"), 64); err == nil && rate > 0 {
+		timing.frameRate = rate
+		timing.tickRate = rate
+	}
+	if multiplier := strings.Fields(tt.attr("frameRateMultiplier")); len(multiplier) == 2 {
+		num, _ := strconv.ParseFloat(multiplier[0], 64)
+		den, _ := strconv.ParseFloat(multiplier[1], 64)
+		if num > 0 && den > 0 {
+			timing.frameRate = timing.frameRate * num / den
+		}
+	}
+	if rate, err := strconv.ParseFloat(tt.attr("subFrameRate"), 64); err == nil && rate > 0 {
+		timing.subFrames = rate
+	}
+	if rate, err := strconv.ParseFloat(tt.attr("tickRate"), 64); err == nil && rate > 0 {
+		timing.tickRate = rate
+	}
+	doc.ttmlTiming = timing
+	doc.xmlRoot = root
+
+	var walk func(node *ttmlNode, offset time.Duration) error
+	walk = func(node *ttmlNode, offset time.Duration) error {
+		for _, child := range node.children {
+			elem, ok := child.token.(xml.StartElement)
+			if !ok {
+				continue
+			}
+			switch elem.Name.Local {
+			case "style", "region":
+				style := map[string]string{}
+				for _, attr := range elem.Attr {
+					style[ttmlAttrName(attr.Name)] = attr.Value
+				}
+				doc.Styles[child.attr("id")] = style
+			case "p":
+				cue, err := newTTMLCue(child, offset, timing)
+				if err != nil {
+					return err
+				}
+				cue.Index = len(doc.Cues) + 1
+				doc.Cues = append(doc.Cues, cue)
+				continue
+			case "body", "div":
+				if begin := child.attr("begin"); len(begin) > 0 {
+					childOffset, err := parseTTMLTime(begin, timing)
+					if err != nil {
+						return err
+					}
+					if err = walk(child, offset+childOffset); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if err := walk(child, offset); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root, 0); err != nil {
+		return doc, err
+	}
+
+	return doc, nil
+}
+
+func newTTMLCue(node *ttmlNode, offset time.Duration, timing ttmlTiming) (*Cue, error) {
+	cue := &Cue{Meta: map[string]string{}, node: node}
+	cue.Meta[metaOffset] = strconv.FormatInt(int64(offset), 10)
+	for _, attr := range []string{"begin", "end", "dur", "style", "region"} {
+		if val := node.attr(attr); len(val) > 0 {
+			cue.Meta[attr] = val
+		}
+	}
+
+	var err error
+	cue.Start = offset
+	if begin := cue.Meta["begin"]; len(begin) > 0 {
+		if cue.Start, err = parseTTMLTime(begin, timing); err != nil {
+			return cue, err
+		}
+		cue.Start += offset
+	}
+	cue.End = cue.Start
+	if end := cue.Meta["end"]; len(end) > 0 {
+		if cue.End, err = parseTTMLTime(end, timing); err != nil {
+			return cue, err
+		}
+		cue.End += offset
+	} else if dur := cue.Meta["dur"]; len(dur) > 0 {
+		d, err := parseTTMLTime(dur, timing)
+		if err != nil {
+			return cue, err
+		}
+		cue.End = cue.Start + d
+	}
+
+	var sb strings.Builder
+	for _, child := range node.children {
+		child.write(&sb)
+	}
+	for _, line := range ttmlBrRe.Split(sb.String(), -1) {
+		cue.Lines = append(cue.Lines, strings.TrimSpace(ttmlSpaces.ReplaceAllString(line, " ")))
+	}
+	cue.Meta[metaOriginal] = strings.Join(cue.Lines, LN_BREAK)
+	return cue, nil
+}
+
+func (doc *Document) ttmlLines() []string {
+	if doc.xmlRoot == nil {
+		return []string{}
+	}
+	for _, cue := range doc.Cues {
+		cue.updateTTMLNode(doc.ttmlTiming)
+	}
+	var sb strings.Builder
+	for _, child := range doc.xmlRoot.children {
+		child.write(&sb)
+	}
+	return strings.Split(sb.String(), LN_BREAK)
+}
+
+// updateTTMLNode writes the cue text and timing back to its <p> element
+func (cue *Cue) updateTTMLNode(timing ttmlTiming) {
+	if cue.node == nil {
+		return
+	}
+	elem := cue.node.token.(xml.StartElement)
+	offset, _ := strconv.ParseInt(cue.Meta[metaOffset], 10, 64)
+
+	setTime := func(attr string, d time.Duration) {
+		original := cue.Meta[attr]
+		if len(original) == 0 {
+			return
+		}
+		if parsed, err := parseTTMLTime(original, timing); err == nil && parsed == d {
+			return
+		}
+		cue.node.setAttr(attr, formatTTMLTime(d, original, timing))
+	}
+	setTime("begin", cue.Start-time.Duration(offset))
+	setTime("end", cue.End-time.Duration(offset))
+	setTime("dur", cue.End-cue.Start)
+
+	// always rewritten, the node may hold the text of another translation
+	text := strings.Join(cue.Lines, LN_BREAK)
+	br := "<br/>"
+	if len(elem.Name.Space) > 0 {
+		br = "<" + elem.Name.Space + ":br/>"
+	}
+	children, err := parseTTMLFragment(strings.Join(cue.Lines, br))
+	if err != nil {
+		// the translation broke the inline markup, keeps the plain text only
+		var nodes []*ttmlNode
+		for i, line := range cue.Lines {
+			if i > 0 {
+				nodes = append(nodes, &ttmlNode{token: xml.StartElement{Name: xml.Name{Space: elem.Name.Space, Local: "br"}}})
+			}
+			plain := html.UnescapeString(ttmlTagRe.ReplaceAllString(line, ""))
+			nodes = append(nodes, &ttmlNode{token: xml.CharData(plain)})
+		}
+		children = nodes
+	}
+	cue.node.children = children
+	cue.Meta[metaOriginal] = text
+}
+
+func parseTTMLFragment(fragment string) ([]*ttmlNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader("<fragment>" + fragment + "</fragment>"))
+	root := &ttmlNode{}
+	stack := []*ttmlNode{root}
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch tk := token.(type) {
+		case xml.EndElement:
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unbalanced </%s>", tk.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			node := &ttmlNode{token: xml.CopyToken(tk)}
+			parent.children = append(parent.children, node)
+			if _, ok := tk.(xml.StartElement); ok {
+				stack = append(stack, node)
+			}
+		}
+	}
+	if len(stack) != 1 || len(root.children) != 1 {
+		return nil, fmt.Errorf("unbalanced fragment")
+	}
+	return root.children[0].children, nil
+}
+
+func (node *ttmlNode) write(sb *strings.Builder) {
+	switch tk := node.token.(type) {
+	case xml.StartElement:
+		sb.WriteString("<" + ttmlAttrName(tk.Name))
+		for _, attr := range tk.Attr {
+			sb.WriteString(" " + ttmlAttrName(attr.Name) + `="` + ttmlEscape(attr.Value, true) + `"`)
+		}
+		if len(node.children) == 0 {
+			sb.WriteString("/>")
+			return
+		}
+		sb.WriteString(">")
+		for _, child := range node.children {
+			child.write(sb)
+		}
+		sb.WriteString("</" + ttmlAttrName(tk.Name) + ">")
+	case xml.CharData:
+		sb.WriteString(ttmlEscape(string(tk), false))
+	case xml.Comment:
+		sb.WriteString("<!--" + string(tk) + "-->")
+	case xml.ProcInst:
+		sb.WriteString("<?" + tk.Target + " " + string(tk.Inst) + "?>")
+	case xml.Directive:
+		sb.WriteString("<!" + string(tk) + ">")
+	}
+}
+
+func (node *ttmlNode) findElement(local string) *ttmlNode {
+	for _, child := range node.children {
+		if elem, ok := child.token.(xml.StartElement); ok && elem.Name.Local == local {
+			return child
+		}
+	}
+	return nil
+}
+
+// attr gets an attribute by its local name, ignoring the namespace prefix
+func (node *ttmlNode) attr(local string) string {
+	elem, ok := node.token.(xml.StartElement)
+	if !ok {
+		return ""
+	}
+	for _, attr := range elem.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// copy deep copies the tree, nodes maps every node to its copy
+func (node *ttmlNode) copy(nodes map[*ttmlNode]*ttmlNode) *ttmlNode {
+	nodeCopy := &ttmlNode{token: xml.CopyToken(node.token)}
+	nodes[node] = nodeCopy
+	for _, child := range node.children {
+		nodeCopy.children = append(nodeCopy.children, child.copy(nodes))
+	}
+	return nodeCopy
+}
+
+func (node *ttmlNode) setAttr(local, value string) {
+	elem := node.token.(xml.StartElement)
+	for i, attr := range elem.Attr {
+		if attr.Name.Local == local {
+			elem.Attr[i].Value = value
+			return
+		}
+	}
+	elem.Attr = append(elem.Attr, xml.Attr{Name: xml.Name{Local: local}, Value: value})
+	node.token = elem
+}
+
+func ttmlAttrName(name xml.Name) string {
+	if len(name.Space) > 0 {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+func ttmlEscape(text string, isAttr bool) string {
+	text = strings.ReplaceAll(text, "&", "&amp;")
+	text = strings.ReplaceAll(text, "<", "&lt;")
+	text = strings.ReplaceAll(text, ">", "&gt;")
+	if isAttr {
+		text = strings.ReplaceAll(text, `"`, "&quot;")
+	}
+	return text
+}
+
+// parseTTMLTime parses any TTML time expression: clock time (00:00:01.500),
+// clock time with frames (00:00:01:12) or offset time (1.5s, 1500ms, 36f, 1000t...)
+func parseTTMLTime(expr string, timing ttmlTiming) (time.Duration, error) {
+	expr = strings.TrimSpace(expr)
+	if matches := ttmlClockTimeRe.FindStringSubmatch(expr); matches != nil {
+		h, _ := strconv.Atoi(matches[1])
+		m, _ := strconv.Atoi(matches[2])
+		s, _ := strconv.Atoi(matches[3])
+		secs := float64(h*3600 + m*60 + s)
+		if len(matches[4]) > 0 {
+			frac, _ := strconv.ParseFloat("0."+matches[4], 64)
+			secs += frac
+		}
+		if len(matches[5]) > 0 {
+			frames, _ := strconv.ParseFloat(matches[5], 64)
+			if len(matches[6]) > 0 {
+				subFrames, _ := strconv.ParseFloat(matches[6], 64)
+				frames += subFrames / timing.subFrames
+			}
+			secs += frames / timing.frameRate
+		}
+		return secondsToDuration(secs), nil
+	}
+	if matches := ttmlOffsetTimeRe.FindStringSubmatch(expr); matches != nil {
+		val, _ := strconv.ParseFloat(matches[1], 64)
+		switch matches[2] {
+		case "h":
+			val *= 3600
+		case "m":
+			val *= 60
+		case "ms":
+			val /= 1000
+		case "f":
+			val /= timing.frameRate
+		case "t":
+			val /= timing.tickRate
+		}
+		return secondsToDuration(val), nil
+	}
+	return 0, fmt.Errorf("[transub] invalid ttml time expression '%s'", expr)
+}
+
+// formatTTMLTime formats d with the same kind of expression used by original
+func formatTTMLTime(d time.Duration, original string, timing ttmlTiming) string {
+	if d < 0 {
+		d = 0
+	}
+	secs := d.Seconds()
+	if matches := ttmlOffsetTimeRe.FindStringSubmatch(strings.TrimSpace(original)); matches != nil {
+		switch unit := matches[2]; unit {
+		case "ms":
+			return fmt.Sprintf("%dms", d.Milliseconds())
+		case "f":
+			return fmt.Sprintf("%df", int64(math.Round(secs*timing.frameRate)))
+		case "t":
+			return fmt.Sprintf("%dt", int64(math.Round(secs*timing.tickRate)))
+		default:
+			return strconv.FormatFloat(math.Round(secs*1000)/1000, 'f', -1, 64) + "s"
+		}
+	}
+
+	h := int64(secs) / 3600
+	m := int64(secs) / 60 % 60
+	s := int64(secs) % 60
+	clock := fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	matches := ttmlClockTimeRe.FindStringSubmatch(strings.TrimSpace(original))
+	if matches != nil && len(matches[5]) > 0 {
+		frames := int64(math.Round((secs - math.Floor(secs)) * timing.frameRate))
+		return fmt.Sprintf("%s:%02d", clock, frames)
+	}
+	ms := (d % time.Second) / time.Millisecond
+	return fmt.Sprintf("%s.%03d", clock, ms)
+}
+
+func secondsToDuration(secs float64) time.Duration {
+	return time.Duration(math.Round(secs * float64(time.Second)))
+}
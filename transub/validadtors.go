@@ -19,8 +19,10 @@ func (v validate) isTextFile(filename string) (ok bool, err error) {
 	if err != nil {
 		return false, err
 	}
-	cType := http.DetectContentType(fBytes)
-	return strings.HasPrefix(cType, textPlainMIME), nil
+	// DetectContentType takes UTF-16 and legacy encodings as binary data
+	text, _ := decodeText(fBytes)
+	cType := http.DetectContentType([]byte(text))
+	return strings.HasPrefix(cType, textPlainMIME) || strings.HasPrefix(cType, textXMLMIME), nil
 }
 
 func (v validate) isReachableFile(filename string) bool {
@@ -52,19 +54,10 @@ func (v validate) isMusic(line string) bool {
 	return strings.HasPrefix(line, "♪")
 }
 
+// isTimestampStr checks for a whole srt timing line, not just a line that
+// starts with digits
 func (v validate) isTimestampStr(line string) bool {
-	if len(line) < 2 {
-		return false
-	}
-	asciiZero := 48
-	asciiNine := 57
-	firstChar := int(line[0])
-	secndChar := int(line[1])
-	if (firstChar >= asciiZero && firstChar <= asciiNine) &&
-		(secndChar >= asciiZero && secndChar <= asciiNine) {
-		return true
-	}
-	return false
+	return srtTimingRe.MatchString(strings.TrimSpace(line))
 }
 
 func (v validate) isTranslatable(line string, removeCloseCaption bool) bool {
@@ -77,6 +70,23 @@ func (v validate) isTranslatable(line string, removeCloseCaption bool) bool {
 	return shouldTranslate
 }
 
+// isTranslatableText checks a cue text line. Unlike isTranslatable it
+// knows the line is not an index or a timestamp
+func (v validate) isTranslatableText(line string, removeCloseCaption bool) bool {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 || v.isMusicOnly(line) {
+		return false
+	}
+	if removeCloseCaption {
+		return !v.isCC(line)
+	}
+	return true
+}
+
+func (v validate) isMusicOnly(line string) bool {
+	return len(strings.Trim(line, "♪♫ ")) == 0
+}
+
 // func (v validate) getIntVal(line string) (int, bool) {
 // 	val, err := strconv.Atoi(line)
 // 	if err != nil {
@@ -0,0 +1,122 @@
+package transub
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// eg: 00:01:48.083 --> 00:01:50.792 line:10% align:start
+	vttTimingRe = regexp.MustCompile(`^(\S+)\s+-->\s+(\S+)(.*)$`)
+	// voice <v Speaker>, class <c.yellow>, <i>, <b>, <u>, <ruby>, <lang> and timestamps <00:00:01.000>
+	vttTagRe = regexp.MustCompile(`</?[a-zA-Z0-9:.][^>]*>`)
+)
+
+func parseVTT(lines []string) (*Document, error) {
+	doc := &Document{Format: FormatVTT, Meta: map[string]string{}}
+
+	blocks := splitBlocks(lines)
+	if len(blocks) == 0 || !strings.HasPrefix(blocks[0][0], vttSignature) {
+		return doc, fmt.Errorf("[transub] missing WEBVTT signature. This might not be an actual .vtt file")
+	}
+
+	for _, block := range blocks {
+		timingIdx := -1
+		for i := 0; i < len(block) && i < 2; i++ {
+			if vttTimingRe.MatchString(block[i]) {
+				timingIdx = i
+				break
+			}
+		}
+
+		// header, NOTE, STYLE and REGION blocks are kept as they are
+		if timingIdx < 0 {
+			if len(doc.Cues) == 0 {
+				doc.Header = append(doc.Header, block...)
+				doc.Header = append(doc.Header, "")
+				continue
+			}
+			cue := &Cue{Lines: block, Meta: map[string]string{metaRaw: "true"}}
+			cue.Meta[metaTranslatable] = "false"
+			doc.Cues = append(doc.Cues, cue)
+			continue
+		}
+
+		cue := &Cue{Index: len(doc.Cues) + 1, Meta: map[string]string{}}
+		if timingIdx == 1 {
+			cue.Meta[metaID] = block[0]
+		}
+		matches := vttTimingRe.FindStringSubmatch(block[timingIdx])
+		var err error
+		if cue.Start, err = parseClockTimestamp(matches[1]); err != nil {
+			return doc, err
+		}
+		if cue.End, err = parseClockTimestamp(matches[2]); err != nil {
+			return doc, err
+		}
+		if settings := strings.TrimSpace(matches[3]); len(settings) > 0 {
+			cue.Meta[metaSettings] = settings
+		}
+		cue.Lines = append([]string{}, block[timingIdx+1:]...)
+		doc.Cues = append(doc.Cues, cue)
+	}
+	doc.Header = trimBlankLines(doc.Header)
+
+	return doc, nil
+}
+
+func (doc *Document) vttLines() []string {
+	lines := append([]string{}, doc.Header...)
+	if len(lines) == 0 {
+		lines = append(lines, vttSignature)
+	}
+	lines = append(lines, "")
+	for _, cue := range doc.Cues {
+		if cue.Meta[metaRaw] == "true" {
+			lines = append(lines, cue.Lines...)
+			lines = append(lines, "")
+			continue
+		}
+		if id := cue.Meta[metaID]; len(id) > 0 {
+			lines = append(lines, id)
+		}
+		timing := formatVTTTimestamp(cue.Start) + " --> " + formatVTTTimestamp(cue.End)
+		if settings := cue.Meta[metaSettings]; len(settings) > 0 {
+			timing += " " + settings
+		}
+		lines = append(lines, timing)
+		lines = append(lines, cue.Lines...)
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// formatVTTTimestamp formats as 00:01:48.083
+func formatVTTTimestamp(d time.Duration) string {
+	return strings.Replace(formatSRTTimestamp(d), ",", ".", 1)
+}
+
+// splitBlocks groups lines separated by blank lines
+func splitBlocks(lines []string) [][]string {
+	var blocks [][]string
+	var block []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, META_TRASNLATED) {
+			continue
+		}
+		if Validator.isLineBreak(strings.TrimSpace(line)) {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+	return blocks
+}